@@ -0,0 +1,211 @@
+// Package ahocorasick finds which of a set of strings turn up in a text, in
+// one pass over the text however many strings there are.
+//
+// The strings are put in a trie, and each node of it is given a failure link
+// to the node for the longest suffix of its string that is also in the trie.
+// Following a byte from a node that has no edge for it goes along failure
+// links until one does, so the text never has to be looked at twice.
+package ahocorasick
+
+import (
+	"slices"
+)
+
+// Options say how the patterns are compared with the text
+type Options struct {
+	// CaseInsensitive matches ASCII letters whatever their case. Other
+	// letters have to match exactly.
+	CaseInsensitive bool
+}
+
+// Match is where one of the patterns was found
+type Match struct {
+	Pattern int // index of the pattern in those given to New
+	Start   int // offset of the first byte of the match in the text
+	End     int // offset of the byte after the match
+}
+
+// Matcher is the trie for a set of patterns, with its failure links. The
+// search methods only read it.
+type Matcher struct {
+	nodes    []node
+	root     [256]int32 // the edges out of the root, which are looked up most
+	maxLen   int
+	caseless bool
+}
+
+// node is a node of the trie, standing for the string spelt out on the way
+// to it from the root
+type node struct {
+	edges []edge // sorted by byte
+	fail  int32  // the node for the longest proper suffix in the trie
+	out   int32  // the first pattern that is this node's string, -1 for none
+	dict  int32  // the next node along the failure links with an out, -1 for none
+	depth int32  // the length of the string
+}
+
+type edge struct {
+	b  byte
+	to int32
+}
+
+// New builds a Matcher for patterns
+func New(patterns [][]byte, opts Options) *Matcher {
+	m := &Matcher{caseless: opts.CaseInsensitive}
+	m.nodes = append(m.nodes, node{out: -1, dict: -1})
+	for p, pattern := range patterns {
+		n := int32(0)
+		for _, b := range pattern {
+			n = m.extend(n, m.fold(b))
+		}
+		if m.nodes[n].out < 0 {
+			m.nodes[n].out = int32(p)
+		}
+		m.maxLen = max(m.maxLen, len(pattern))
+	}
+	m.link()
+	return m
+}
+
+// fold returns b with any ASCII upper case letter lowered if caseless
+func (m *Matcher) fold(b byte) byte {
+	if m.caseless && 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// child returns the node at the end of n's edge for b, or -1
+func (m *Matcher) child(n int32, b byte) int32 {
+	edges := m.nodes[n].edges
+	i, found := slices.BinarySearchFunc(edges, b, func(e edge, b byte) int {
+		return int(e.b) - int(b)
+	})
+	if !found {
+		return -1
+	}
+	return edges[i].to
+}
+
+// extend returns the node at the end of n's edge for b, adding it if need be
+func (m *Matcher) extend(n int32, b byte) int32 {
+	edges := m.nodes[n].edges
+	i, found := slices.BinarySearchFunc(edges, b, func(e edge, b byte) int {
+		return int(e.b) - int(b)
+	})
+	if found {
+		return edges[i].to
+	}
+	to := int32(len(m.nodes))
+	m.nodes = append(m.nodes, node{out: -1, dict: -1, depth: m.nodes[n].depth + 1})
+	m.nodes[n].edges = slices.Insert(edges, i, edge{b, to})
+	return to
+}
+
+// link fills in the failure and dictionary links a level of the trie at a
+// time, as each node's links come from those of its parent, which is
+// shallower
+func (m *Matcher) link() {
+	queue := []int32{}
+	for _, e := range m.nodes[0].edges {
+		m.root[e.b] = e.to
+		queue = append(queue, e.to)
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, e := range m.nodes[n].edges {
+			fail := m.step(m.nodes[n].fail, e.b)
+			m.nodes[e.to].fail = fail
+			if m.nodes[fail].out >= 0 && fail != 0 {
+				m.nodes[e.to].dict = fail
+			} else {
+				m.nodes[e.to].dict = m.nodes[fail].dict
+			}
+			queue = append(queue, e.to)
+		}
+	}
+}
+
+// step returns the node after n for the byte b, which has already been
+// folded
+func (m *Matcher) step(n int32, b byte) int32 {
+	for n != 0 {
+		if to := m.child(n, b); to >= 0 {
+			return to
+		}
+		n = m.nodes[n].fail
+	}
+	return m.root[b]
+}
+
+// Match reports whether any of the patterns turns up in text
+func (m *Matcher) Match(text []byte) bool {
+	if m.nodes[0].out >= 0 {
+		return true
+	}
+	n := int32(0)
+	for _, b := range text {
+		n = m.step(n, m.fold(b))
+		if m.nodes[n].out >= 0 || m.nodes[n].dict >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the leftmost match in text and whether there was one. Of the
+// patterns that match there, the first one given to New wins, as it would in
+// a regular expression alternation.
+func (m *Matcher) Find(text []byte) (Match, bool) {
+	best := Match{Pattern: -1}
+	// an empty pattern matches at the very start
+	if out := m.nodes[0].out; out >= 0 {
+		best = Match{Pattern: int(out)}
+	}
+	n := int32(0)
+	for i, b := range text {
+		// anything starting before best that is still to be found would
+		// have ended by now
+		if best.Pattern >= 0 && i >= best.Start+m.maxLen {
+			break
+		}
+		n = m.step(n, m.fold(b))
+		o := n
+		if m.nodes[o].out < 0 {
+			o = m.nodes[o].dict
+		}
+		for ; o >= 0; o = m.nodes[o].dict {
+			found := Match{
+				Pattern: int(m.nodes[o].out),
+				Start:   i + 1 - int(m.nodes[o].depth),
+				End:     i + 1,
+			}
+			if best.Pattern < 0 || found.Start < best.Start ||
+				found.Start == best.Start && found.Pattern < best.Pattern {
+				best = found
+			}
+		}
+	}
+	return best, best.Pattern >= 0
+}
+
+// FindAll returns the successive matches in text that do not overlap, each
+// the one Find would give for the text after the last
+func (m *Matcher) FindAll(text []byte) []Match {
+	var matches []Match
+	for pos := 0; pos <= len(text); {
+		found, ok := m.Find(text[pos:])
+		if !ok {
+			break
+		}
+		found.Start += pos
+		found.End += pos
+		matches = append(matches, found)
+		pos = found.End
+		if found.End == found.Start {
+			pos++
+		}
+	}
+	return matches
+}
@@ -0,0 +1,172 @@
+package ahocorasick
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func words(ws ...string) [][]byte {
+	patterns := make([][]byte, len(ws))
+	for i, w := range ws {
+		patterns[i] = []byte(w)
+	}
+	return patterns
+}
+
+type FindInput struct {
+	name     string
+	patterns []string
+	caseless bool
+	text     string
+	all      []Match
+}
+
+var findTests = []FindInput{
+	{
+		name:     "one",
+		patterns: []string{"cat"},
+		text:     "the cat sat on the cat",
+		all:      []Match{{0, 4, 7}, {0, 19, 22}},
+	},
+	{
+		name:     "none",
+		patterns: []string{"cat", "dog"},
+		text:     "the cow",
+		all:      nil,
+	},
+	{
+		name:     "which",
+		patterns: []string{"foo", "bar", "baz"},
+		text:     "xbazbarfoo",
+		all:      []Match{{2, 1, 4}, {1, 4, 7}, {0, 7, 10}},
+	},
+	{
+		name:     "leftmost_wins",
+		patterns: []string{"bcd", "abcde"},
+		text:     "abcde",
+		all:      []Match{{1, 0, 5}},
+	},
+	{
+		name:     "first_pattern_wins",
+		patterns: []string{"ab", "abc"},
+		text:     "abc",
+		all:      []Match{{0, 0, 2}},
+	},
+	{
+		name:     "first_pattern_wins_longer",
+		patterns: []string{"abc", "ab"},
+		text:     "abc",
+		all:      []Match{{0, 0, 3}},
+	},
+	{
+		name:     "suffix_found_through_failure",
+		patterns: []string{"abcx", "bc"},
+		text:     "abcy",
+		all:      []Match{{1, 1, 3}},
+	},
+	{
+		name:     "dictionary_link",
+		patterns: []string{"she", "he", "hers"},
+		text:     "ushers",
+		all:      []Match{{0, 1, 4}},
+	},
+	{
+		name:     "no_overlap",
+		patterns: []string{"aa"},
+		text:     "aaaaa",
+		all:      []Match{{0, 0, 2}, {0, 2, 4}},
+	},
+	{
+		name:     "duplicate_patterns",
+		patterns: []string{"x", "y", "x"},
+		text:     "yx",
+		all:      []Match{{1, 0, 1}, {0, 1, 2}},
+	},
+	{
+		name:     "empty_pattern",
+		patterns: []string{"b", ""},
+		text:     "ab",
+		all:      []Match{{1, 0, 0}, {0, 1, 2}, {1, 2, 2}},
+	},
+	{
+		name:     "caseless",
+		patterns: []string{"Error", "WARN"},
+		caseless: true,
+		text:     "ERROR warn",
+		all:      []Match{{0, 0, 5}, {1, 6, 10}},
+	},
+	{
+		name:     "case_sensitive",
+		patterns: []string{"Error", "WARN"},
+		text:     "ERROR warn Error",
+		all:      []Match{{0, 11, 16}},
+	},
+	{
+		name:     "bytes",
+		patterns: []string{"caf\xc3\xa9", "\xff"},
+		text:     "\xffcafé",
+		all:      []Match{{1, 0, 1}, {0, 1, 6}},
+	},
+}
+
+func TestFindAll(t *testing.T) {
+	for _, tt := range findTests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(words(tt.patterns...), Options{CaseInsensitive: tt.caseless})
+			if got := m.FindAll([]byte(tt.text)); !reflect.DeepEqual(got, tt.all) {
+				t.Errorf("FindAll(%q) = %v; want %v", tt.text, got, tt.all)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	for _, tt := range findTests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(words(tt.patterns...), Options{CaseInsensitive: tt.caseless})
+			got, ok := m.Find([]byte(tt.text))
+			if ok != (tt.all != nil) || ok && got != tt.all[0] {
+				t.Errorf("Find(%q) = %v, %v; want %v", tt.text, got, ok, tt.all)
+			}
+			if matched := m.Match([]byte(tt.text)); matched != ok {
+				t.Errorf("Match(%q) = %v; want %v", tt.text, matched, ok)
+			}
+		})
+	}
+}
+
+// TestManyPatterns checks a large word list against looking for each word
+// in turn
+func TestManyPatterns(t *testing.T) {
+	var ids []string
+	for i := 0; i < 20000; i++ {
+		ids = append(ids, fmt.Sprintf("CUST-%d", i*7919%100000))
+	}
+	m := New(words(ids...), Options{})
+	for _, text := range []string{
+		"order placed by CUST-7919 today",
+		"order placed by CUST-99999 today",
+		"refund for CUST-1234 and CUST-15838",
+		"no customer here",
+	} {
+		want := Match{Pattern: -1}
+		for p, id := range ids {
+			start := bytes.Index([]byte(text), []byte(id))
+			if start < 0 {
+				continue
+			}
+			if want.Pattern < 0 || start < want.Start {
+				want = Match{p, start, start + len(id)}
+			}
+		}
+		got, ok := m.Find([]byte(text))
+		if !ok {
+			got = Match{Pattern: -1}
+		}
+		if got != want {
+			t.Errorf("Find(%q) = %v; want %v", text, got, want)
+		}
+	}
+}
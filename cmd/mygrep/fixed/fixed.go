@@ -0,0 +1,183 @@
+// Package fixed finds a fixed string in text with the Boyer-Moore-Horspool
+// algorithm, with no regular expression syntax to get in the way.
+//
+// Horspool compares the pattern against the text from its last byte back,
+// and when they differ moves along by how far back in the pattern the text
+// byte under its last byte turns up, the whole length of the pattern if it
+// does not. On most text that skips over most bytes without looking at them.
+package fixed
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Options control case folding
+type Options struct {
+	// CaseInsensitive matches letters whatever their case
+	CaseInsensitive bool
+	// UTF8 treats the pattern and text as UTF-8, so that case is folded the
+	// Unicode way. Otherwise only ASCII letters are.
+	UTF8 bool
+}
+
+// Searcher is a pattern with its table of skips, worked out once by New so
+// that each search can go straight to comparing bytes
+type Searcher struct {
+	pattern  []byte // folded if caseless
+	skip     [256]int
+	caseless bool // ASCII letters match whatever their case
+	unicode  bool // the text has to be folded before searching it
+}
+
+// New returns a Searcher for pattern
+func New(pattern []byte, opts Options) *Searcher {
+	s := &Searcher{caseless: opts.CaseInsensitive}
+	if opts.CaseInsensitive && opts.UTF8 && NeedsUnicodeFolding(pattern) {
+		s.unicode, s.caseless = true, false
+		pattern, _ = FoldText(pattern)
+	}
+	s.pattern = make([]byte, len(pattern))
+	for i, b := range pattern {
+		s.pattern[i] = s.fold(b)
+	}
+
+	m := len(s.pattern)
+	for b := range s.skip {
+		s.skip[b] = m
+	}
+	// the last byte is left out, as after matching it we need to know how
+	// far back it next turns up
+	for i := 0; i < m-1; i++ {
+		s.skip[s.pattern[i]] = m - 1 - i
+		if s.caseless {
+			s.skip[upper(s.pattern[i])] = m - 1 - i
+		}
+	}
+	return s
+}
+
+// NeedsUnicodeFolding reports whether the UTF-8 pattern has a letter that is
+// the same as some other than ASCII letters when case is ignored, like k and
+// the Kelvin sign K
+func NeedsUnicodeFolding(pattern []byte) bool {
+	for _, r := range string(pattern) {
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f >= utf8.RuneSelf || r >= utf8.RuneSelf {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fold returns b with any ASCII upper case letter lowered if caseless
+func (s *Searcher) fold(b byte) byte {
+	if s.caseless && 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// upper returns b with any ASCII lower case letter raised
+func upper(b byte) byte {
+	if 'a' <= b && b <= 'z' {
+		return b - ('a' - 'A')
+	}
+	return b
+}
+
+// Match reports whether the pattern turns up in text
+func (s *Searcher) Match(text []byte) bool {
+	return s.Index(text) != nil
+}
+
+// Index returns the start and end offsets of the first place the pattern
+// turns up in text, or nil if it does not. Ignoring case, the text matched
+// need not be as long as the pattern.
+func (s *Searcher) Index(text []byte) []int {
+	if !s.unicode {
+		i := s.index(text)
+		if i < 0 {
+			return nil
+		}
+		return []int{i, i + len(s.pattern)}
+	}
+
+	folded, starts := FoldText(text)
+	i := s.index(folded)
+	if i < 0 {
+		return nil
+	}
+	end := len(text)
+	if j := i + len(s.pattern); j < len(folded) {
+		end = starts[j]
+	}
+	return []int{starts[i], end}
+}
+
+// index is Horspool's search for the pattern in text
+func (s *Searcher) index(text []byte) int {
+	m := len(s.pattern)
+	switch {
+	case m == 0:
+		return 0
+	case m == 1 && !s.caseless:
+		return bytes.IndexByte(text, s.pattern[0])
+	}
+	last := s.pattern[m-1]
+	for i := 0; i+m <= len(text); i += s.skip[text[i+m-1]] {
+		if s.fold(text[i+m-1]) == last && s.equal(text[i:i+m-1]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// equal reports whether text is the pattern but for its last byte
+func (s *Searcher) equal(text []byte) bool {
+	if !s.caseless {
+		return bytes.Equal(text, s.pattern[:len(text)])
+	}
+	for i, b := range text {
+		if s.fold(b) != s.pattern[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// FoldText replaces each character of the UTF-8 text with the smallest of
+// those that are the same when case is ignored, returning where in text each
+// byte of the result came from. Each byte of invalid UTF-8 is left as it is.
+// Two texts folded this way are equal exactly when they are the same but for
+// case, however many bytes each spelling of a letter takes.
+func FoldText(text []byte) (folded []byte, starts []int) {
+	folded = make([]byte, 0, len(text))
+	starts = make([]int, 0, len(text))
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRune(text[i:])
+		n := len(folded)
+		if r == utf8.RuneError && size == 1 {
+			folded = append(folded, text[i])
+		} else {
+			folded = utf8.AppendRune(folded, foldRune(r))
+		}
+		for ; n < len(folded); n++ {
+			starts = append(starts, i)
+		}
+		i += size
+	}
+	return folded, starts
+}
+
+// foldRune returns the smallest of the characters that are the same as r
+// when case is ignored
+func foldRune(r rune) rune {
+	least := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		least = min(least, f)
+	}
+	return least
+}
@@ -0,0 +1,218 @@
+package fixed
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type IndexInput struct {
+	name    string
+	pattern string
+	opts    Options
+	text    string
+	index   []int // nil for no match
+}
+
+var caseless = Options{CaseInsensitive: true}
+var unicodeCaseless = Options{CaseInsensitive: true, UTF8: true}
+
+var indexTests = []IndexInput{
+	{
+		name:    "found",
+		pattern: "needle",
+		text:    "haystack with a needle in it",
+		index:   []int{16, 22},
+	},
+	{
+		name:    "first_of_several",
+		pattern: "ab",
+		text:    "xxabxab",
+		index:   []int{2, 4},
+	},
+	{
+		name:    "not_found",
+		pattern: "needle",
+		text:    "haystack",
+		index:   nil,
+	},
+	{
+		name:    "longer_than_text",
+		pattern: "needles",
+		text:    "needle",
+		index:   nil,
+	},
+	{
+		name:    "metacharacters_are_literal",
+		pattern: "a.b[c]",
+		text:    "axb[c] a.b[c]",
+		index:   []int{7, 13},
+	},
+	{
+		name:    "at_start",
+		pattern: "abc",
+		text:    "abcabc",
+		index:   []int{0, 3},
+	},
+	{
+		name:    "at_end",
+		pattern: "abc",
+		text:    "ababc",
+		index:   []int{2, 5},
+	},
+	{
+		name:    "repeated_bytes",
+		pattern: "aab",
+		text:    "aaaaab",
+		index:   []int{3, 6},
+	},
+	{
+		name:    "one_byte",
+		pattern: "z",
+		text:    "xyz",
+		index:   []int{2, 3},
+	},
+	{
+		name:    "empty_pattern",
+		pattern: "",
+		text:    "abc",
+		index:   []int{0, 0},
+	},
+	{
+		name:    "case_sensitive",
+		pattern: "Error",
+		text:    "ERROR error Error",
+		index:   []int{12, 17},
+	},
+	{
+		name:    "caseless",
+		pattern: "Error",
+		opts:    caseless,
+		text:    "an eRRoR",
+		index:   []int{3, 8},
+	},
+	{
+		name:    "caseless_one_byte",
+		pattern: "x",
+		opts:    caseless,
+		text:    "aXb",
+		index:   []int{1, 2},
+	},
+	{
+		name:    "caseless_skip_on_upper",
+		pattern: "abcd",
+		opts:    caseless,
+		text:    "xxABCD",
+		index:   []int{2, 6},
+	},
+	{
+		name:    "caseless_ascii_only",
+		pattern: "café",
+		opts:    caseless,
+		text:    "CAFÉ Café",
+		index:   []int{6, 11},
+	},
+	{
+		name:    "unicode_caseless",
+		pattern: "café",
+		opts:    unicodeCaseless,
+		text:    "le CAFÉ",
+		index:   []int{3, 8},
+	},
+	{
+		name:    "unicode_caseless_kelvin",
+		pattern: "kiss",
+		opts:    unicodeCaseless,
+		text:    "a KIſS",
+		index:   []int{2, 9},
+	},
+	{
+		name:    "unicode_caseless_invalid_bytes",
+		pattern: "σ",
+		opts:    unicodeCaseless,
+		text:    "\xff\xceΣ",
+		index:   []int{2, 4},
+	},
+	{
+		name:    "unicode_caseless_ascii_pattern",
+		pattern: "abc",
+		opts:    unicodeCaseless,
+		text:    "xABC",
+		index:   []int{1, 4},
+	},
+}
+
+func TestIndex(t *testing.T) {
+	for _, tt := range indexTests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New([]byte(tt.pattern), tt.opts)
+			if got := s.Index([]byte(tt.text)); !reflect.DeepEqual(got, tt.index) {
+				t.Errorf("Index(%q) = %v; want %v", tt.text, got, tt.index)
+			}
+			if got := s.Match([]byte(tt.text)); got != (tt.index != nil) {
+				t.Errorf("Match(%q) = %v; want %v", tt.text, got, tt.index != nil)
+			}
+		})
+	}
+}
+
+func TestNeedsUnicodeFolding(t *testing.T) {
+	for pattern, want := range map[string]bool{
+		"abc":  false,
+		"123":  false,
+		"kiss": true, // the Kelvin sign and long s
+		"café": true,
+		"日本":   false,
+	} {
+		if got := NeedsUnicodeFolding([]byte(pattern)); got != want {
+			t.Errorf("NeedsUnicodeFolding(%q) = %v; want %v", pattern, got, want)
+		}
+	}
+}
+
+func TestFoldText(t *testing.T) {
+	for _, tt := range []struct {
+		text   string
+		folded string
+		starts []int
+	}{
+		{text: "Kiſs", folded: "KISS", starts: []int{0, 1, 2, 4}},
+		{text: "\u212aey", folded: "KEY", starts: []int{0, 3, 4}},
+		{text: "café", folded: "CAF\u00c9", starts: []int{0, 1, 2, 3, 3}},
+		{text: "a\xffb", folded: "A\xffB", starts: []int{0, 1, 2}},
+		{text: "", folded: "", starts: []int{}},
+	} {
+		folded, starts := FoldText([]byte(tt.text))
+		if string(folded) != tt.folded || !reflect.DeepEqual(starts, tt.starts) {
+			t.Errorf("FoldText(%q) = %q, %v; want %q, %v", tt.text, folded, starts, tt.folded, tt.starts)
+		}
+	}
+}
+
+// TestAgreesWithBytesIndex tries every short pattern over a small alphabet
+// against a text with plenty of near misses
+func TestAgreesWithBytesIndex(t *testing.T) {
+	text := []byte("abacabadabacabaeabacabadabacabaf")
+	var patterns []string
+	for _, a := range "abcdef" {
+		patterns = append(patterns, string(a))
+		for _, b := range "abcdef" {
+			patterns = append(patterns, string(a)+string(b))
+			for _, c := range "abcdef" {
+				patterns = append(patterns, string(a)+string(b)+string(c))
+			}
+		}
+	}
+	for _, pattern := range patterns {
+		want := bytes.Index(text, []byte(pattern))
+		got := New([]byte(pattern), Options{}).Index(text)
+		if got == nil && want >= 0 || got != nil && got[0] != want {
+			t.Errorf("Index(%q) = %v; bytes.Index gives %d", pattern, got, want)
+		}
+		upper := bytes.ToUpper([]byte(pattern))
+		got = New(upper, caseless).Index(text)
+		if got == nil && want >= 0 || got != nil && got[0] != want {
+			t.Errorf("caseless Index(%q) = %v; want %d", upper, got, want)
+		}
+	}
+}
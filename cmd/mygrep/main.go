@@ -1,23 +1,90 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/codecrafters-io/grep-starter-go/cmd/mygrep/ahocorasick"
+	"github.com/codecrafters-io/grep-starter-go/cmd/mygrep/fixed"
 	"github.com/codecrafters-io/grep-starter-go/cmd/mygrep/regexp"
 )
 
-// Usage: echo <input_text> | your_program.sh -E <pattern>
+// Usage: echo <input_text> | your_program.sh -E|-F [-i] <pattern> | -f <file>
 func main() {
-	if len(os.Args) < 3 || os.Args[1] != "-E" {
-		fmt.Fprintf(os.Stderr, "usage: mygrep -E <pattern>\n")
+	extended := flag.Bool("E", false, "interpret the patterns as extended regular expressions")
+	var fixedStrings bool
+	flag.BoolVar(&fixedStrings, "F", false, "interpret the patterns as fixed strings")
+	flag.BoolVar(&fixedStrings, "fixed-strings", false, "same as -F")
+	patternFile := flag.String("f", "", "take the patterns from `file`, one per line")
+	var ignoreCase bool
+	flag.BoolVar(&ignoreCase, "i", false, "ignore case distinctions in the pattern and the input")
+	flag.BoolVar(&ignoreCase, "ignore-case", false, "same as -i")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: mygrep -E|-F [-i] <pattern>\n       mygrep -E|-F [-i] -f <file>\n")
+	}
+	flag.Parse()
+	// a pattern file takes the place of the pattern
+	wantArgs := 1
+	if *patternFile != "" {
+		wantArgs = 0
+	}
+	if *extended == fixedStrings || flag.NArg() != wantArgs {
+		flag.Usage()
 		os.Exit(2) // 1 means no lines were selected, >1 means error
 	}
 
-	pattern := os.Args[2]
-	regex := regexp.ParseRegExp(pattern)
-	fmt.Fprintf(os.Stderr, "%s\n", regex)
+	var patterns []string
+	if *patternFile != "" {
+		var err error
+		if patterns, err = readPatterns(*patternFile); err != nil {
+			fmt.Fprintf(os.Stderr, "mygrep: %v\n", err)
+			os.Exit(2)
+		}
+	} else {
+		patterns = strings.Split(flag.Arg(0), "\n")
+	}
+
+	var matchLine func(line []byte) bool
+	if fixedStrings {
+		matchLine = newFixedSet(patterns, ignoreCase, utf8Locale()).match
+	} else {
+		opts := regexp.CompileOptions{
+			UTF8:            utf8Locale(),
+			CaseInsensitive: ignoreCase,
+		}
+		var regexes []*regexp.RegExp
+		matchAll := false
+		for _, pattern := range patterns {
+			// an empty pattern matches every line, as it does with -F
+			if pattern == "" {
+				matchAll = true
+				continue
+			}
+			regex, err := regexp.CompileWithOptions(pattern, opts)
+			if err != nil {
+				reportCompileError(pattern, err)
+				os.Exit(2)
+			}
+			regexes = append(regexes, regex)
+		}
+		matchLine = func(line []byte) bool {
+			if matchAll {
+				return true
+			}
+			for _, regex := range regexes {
+				if regex.MatchLine(line) {
+					return true
+				}
+			}
+			return false
+		}
+	}
 
 	// XXX ReadAll assumes we're only dealing with a single line
 	line, err := io.ReadAll(os.Stdin)
@@ -25,10 +92,130 @@ func main() {
 		os.Exit(2)
 	}
 
-	matched := regex.MatchLine(line)
+	matched := matchLine(line)
 	if matched {
 		os.Exit(0)
 	} else {
 		os.Exit(1)
 	}
 }
+
+// fixedSet finds any of a set of patterns in a line, without parsing them
+type fixedSet struct {
+	// matcher finds two or more patterns at once. Aho-Corasick finds any
+	// number of strings in one pass, while a single string is left to
+	// Horspool's search, which is quicker as it need not look at every byte.
+	matcher *ahocorasick.Matcher
+	// fold has lines folded with fixed.FoldText before matcher sees them,
+	// as the patterns were
+	fold      bool
+	searchers []*fixed.Searcher // when there is no matcher
+}
+
+// newFixedSet returns the fixedSet for patterns
+func newFixedSet(patterns []string, ignoreCase bool, utf8Mode bool) *fixedSet {
+	literals := make([][]byte, len(patterns))
+	// the Aho-Corasick automaton only folds ASCII letters, so if any other
+	// letter can match the patterns are folded to one case beforehand
+	unicodeCase := false
+	for i, pattern := range patterns {
+		literals[i] = []byte(pattern)
+		unicodeCase = unicodeCase || ignoreCase && utf8Mode && fixed.NeedsUnicodeFolding(literals[i])
+	}
+
+	f := &fixedSet{}
+	if len(literals) > 1 {
+		if unicodeCase {
+			for i, literal := range literals {
+				literals[i], _ = fixed.FoldText(literal)
+			}
+		}
+		f.matcher = ahocorasick.New(literals, ahocorasick.Options{CaseInsensitive: ignoreCase && !unicodeCase})
+		f.fold = unicodeCase
+		return f
+	}
+	for _, literal := range literals {
+		f.searchers = append(f.searchers, fixed.New(literal, fixed.Options{CaseInsensitive: ignoreCase, UTF8: utf8Mode}))
+	}
+	return f
+}
+
+// match reports whether any of the patterns turns up in line
+func (f *fixedSet) match(line []byte) bool {
+	return f.index(bytes.TrimRight(line, "\n\r")) != nil
+}
+
+// index returns the start and end offsets in line of the leftmost place any
+// of the patterns turns up, or nil if none does
+func (f *fixedSet) index(line []byte) []int {
+	if f.matcher == nil {
+		var leftmost []int
+		for _, searcher := range f.searchers {
+			if loc := searcher.Index(line); loc != nil && (leftmost == nil || loc[0] < leftmost[0]) {
+				leftmost = loc
+			}
+		}
+		return leftmost
+	}
+	if !f.fold {
+		found, ok := f.matcher.Find(line)
+		if !ok {
+			return nil
+		}
+		return []int{found.Start, found.End}
+	}
+
+	// the line is folded once for all the patterns, and what was found in it
+	// is taken back to where it came from
+	folded, starts := fixed.FoldText(line)
+	found, ok := f.matcher.Find(folded)
+	if !ok {
+		return nil
+	}
+	start, end := len(line), len(line)
+	if found.Start < len(folded) {
+		start = starts[found.Start]
+	}
+	if found.End < len(folded) {
+		end = starts[found.End]
+	}
+	return []int{start, end}
+}
+
+// readPatterns returns the lines of the file at path, with no pattern for
+// the newline ending the last
+func readPatterns(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
+
+// utf8Locale reports whether text should be matched as UTF-8, which it is
+// unless the locale is set to C or POSIX, as with GNU grep. LC_ALL=C is the
+// way to search binary data a byte at a time.
+func utf8Locale() bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if locale := os.Getenv(name); locale != "" {
+			return locale != "C" && locale != "POSIX"
+		}
+	}
+	return true
+}
+
+// reportCompileError explains why pattern was rejected, pointing a caret at
+// the offending part of it when we know where that is
+func reportCompileError(pattern string, err error) {
+	fmt.Fprintf(os.Stderr, "mygrep: %v\n", err)
+	var serr *regexp.SyntaxError
+	if !errors.As(err, &serr) {
+		return
+	}
+	// the offset is in bytes but the caret needs to line up in columns
+	column := utf8.RuneCountInString(pattern[:serr.Offset])
+	fmt.Fprintf(os.Stderr, "  %s\n  %s^\n", pattern, strings.Repeat(" ", column))
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/grep-starter-go/cmd/mygrep/fixed"
+)
+
+// TestMain runs the program itself in place of the tests when asked to, so
+// that the tests can run it as a command
+func TestMain(m *testing.M) {
+	if os.Getenv("MYGREP_RUN_MAIN") != "" {
+		os.Args = append([]string{"mygrep"}, os.Args[1:]...)
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+// run runs the program with args on line, returning its exit status
+func run(t *testing.T, line string, args ...string) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "MYGREP_RUN_MAIN=1")
+	cmd.Stdin = strings.NewReader(line)
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return exit.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("running mygrep %s: %v", strings.Join(args, " "), err)
+	}
+	return 0
+}
+
+func TestPatternFile(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		patterns string
+		line     string
+		status   int
+	}{
+		{name: "match", patterns: "foo\nbar\n", line: "a bar", status: 0},
+		{name: "no_match", patterns: "foo\nbar\n", line: "baz", status: 1},
+		{name: "blank_line_matches_all", patterns: "foo\n\nbar\n", line: "baz", status: 0},
+		{name: "blank_line_alone", patterns: "\n", line: "baz", status: 0},
+		{name: "empty_file_matches_nothing", patterns: "", line: "baz", status: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "patterns")
+			if err := os.WriteFile(path, []byte(tt.patterns), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			// both ways of reading the patterns have to agree
+			for _, mode := range []string{"-E", "-F"} {
+				if got := run(t, tt.line, mode, "-f", path); got != tt.status {
+					t.Errorf("mygrep %s -f %q on %q exited %d; want %d", mode, tt.patterns, tt.line, got, tt.status)
+				}
+			}
+		})
+	}
+}
+
+func TestEmptyPattern(t *testing.T) {
+	for _, mode := range []string{"-E", "-F"} {
+		if got := run(t, "anything", mode, ""); got != 0 {
+			t.Errorf("mygrep %s '' exited %d; want 0", mode, got)
+		}
+	}
+	// an empty pattern does not excuse a malformed one
+	if got := run(t, "anything", "-E", "\nfoo("); got != 2 {
+		t.Errorf("mygrep -E with a malformed pattern exited %d; want 2", got)
+	}
+}
+
+func TestFixedSetFoldsOnce(t *testing.T) {
+	// s and k are the same as ſ and the Kelvin sign when case is ignored,
+	// which almost any list of IDs will have
+	var patterns []string
+	for i := range 1000 {
+		patterns = append(patterns, fmt.Sprintf("sku-%04d", i))
+	}
+	f := newFixedSet(patterns, true, true)
+	if f.matcher == nil || !f.fold {
+		t.Fatalf("%d caseless patterns with s and k are not all found in one pass", len(patterns))
+	}
+	for _, tt := range []struct {
+		line  string
+		index []int
+	}{
+		{line: "order SKU-0042 shipped", index: []int{6, 14}},
+		{line: "order ſku-0042 shipped", index: []int{6, 15}},
+		{line: "order s\u212aU-0999", index: []int{6, 16}},
+		{line: "\u212a ſKU-0001", index: []int{4, 13}},
+		{line: "sku-09999", index: []int{0, 8}},
+		{line: "sku-99", index: nil},
+		{line: "", index: nil},
+	} {
+		if got := f.index([]byte(tt.line)); !reflect.DeepEqual(got, tt.index) {
+			t.Errorf("index(%q) = %v; want %v", tt.line, got, tt.index)
+		}
+		// a Horspool search for each pattern has to agree on whether any is
+		// there
+		want := false
+		for _, pattern := range patterns {
+			s := fixed.New([]byte(pattern), fixed.Options{CaseInsensitive: true, UTF8: true})
+			want = want || s.Match([]byte(tt.line))
+		}
+		if got := f.match([]byte(tt.line)); got != want {
+			t.Errorf("match(%q) = %v; each pattern alone gives %v", tt.line, got, want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "patterns")
+	if err := os.WriteFile(path, []byte(strings.Join(patterns, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LC_ALL", "en_US.UTF-8")
+	if got := run(t, "order ſ\u212aU-0042", "-F", "-i", "-f", path); got != 0 {
+		t.Errorf("mygrep -F -i -f exited %d; want 0", got)
+	}
+	if got := run(t, "order sku-42", "-F", "-i", "-f", path); got != 1 {
+		t.Errorf("mygrep -F -i -f exited %d; want 1", got)
+	}
+}
+
+func TestFixedSetPaths(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		patterns   []string
+		ignoreCase bool
+		utf8       bool
+		matcher    bool
+		fold       bool
+	}{
+		{name: "one", patterns: []string{"kiss"}, ignoreCase: true, utf8: true},
+		{name: "several", patterns: []string{"kiss", "hug"}, matcher: true},
+		{name: "caseless_ascii", patterns: []string{"abc", "def"}, ignoreCase: true, utf8: true, matcher: true},
+		{name: "caseless_unicode", patterns: []string{"kiss", "hug"}, ignoreCase: true, utf8: true, matcher: true, fold: true},
+		{name: "caseless_bytes", patterns: []string{"kiss", "hug"}, ignoreCase: true, matcher: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixedSet(tt.patterns, tt.ignoreCase, tt.utf8)
+			if got := f.matcher != nil; got != tt.matcher {
+				t.Errorf("uses Aho-Corasick = %v; want %v", got, tt.matcher)
+			}
+			if f.fold != tt.fold {
+				t.Errorf("folds lines = %v; want %v", f.fold, tt.fold)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package regexp
+
+import (
+	"encoding/binary"
+	"slices"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/grep-starter-go/cmd/mygrep/regexp/syntax"
+)
+
+///////////////////////////////////////////////////////////
+// A lazy DFA for telling whether a line matches at all
+
+// When all MatchLine wants to know is whether a line matches, the captures
+// and priorities of the Pike VM's threads do not matter, only the set of
+// instructions they are waiting at. The lazy DFA makes a state for each set
+// it comes across, and works out the state after it for a character the first
+// time that character turns up, so most characters of a line cost one lookup
+// in a table.
+//
+// The states are kept in a cache of bounded size, which is emptied when it
+// fills. If it keeps filling on one line the pattern has too many states for
+// the cache to help, and the line is left to the Pike VM.
+
+// defaultCacheSize is how many states a DFA keeps, each of them about 2KB
+const defaultCacheSize = 4096
+
+// the DFA gives up on a line once its cache has been emptied this many times
+// while making a state for fewer than minBytesPerState bytes of the line
+const (
+	maxCacheResets   = 3
+	minBytesPerState = 10
+)
+
+// charKind is what an assertion needs to know of the character on either
+// side of it
+type charKind uint8
+
+const (
+	kindEdge    charKind = iota // the start or end of the line
+	kindNewline                 // \n
+	kindWord                    // a character \w matches
+	kindOther
+)
+
+func kindOf(c rune, utf8Mode bool) charKind {
+	switch {
+	case c == '\n':
+		return kindNewline
+	case syntax.IsWordChar(c, utf8Mode):
+		return kindWord
+	}
+	return kindOther
+}
+
+// dstate is a state of the DFA: the instructions the threads carry on from,
+// and the kind of character they have just used up
+type dstate struct {
+	insts  []int // sorted
+	before charKind
+	next   [256]*dstate     // by character, nil until worked out
+	wide   map[rune]*dstate // the same for characters past 255
+	atEnd  int8             // matches at the end of the line: 1 yes, -1 no, 0 not worked out
+	final  bool             // for matchedState and deadState, which end the search
+}
+
+var (
+	// matchedState follows any state from which the pattern has matched
+	matchedState = &dstate{final: true}
+	// deadState follows any state with no threads left and no new ones to
+	// come, which happens in anchored patterns
+	deadState = &dstate{final: true}
+)
+
+// dfa runs a program a set of threads at a time. The states are built as
+// they are needed, into caches that are each used by one goroutine at once.
+type dfa struct {
+	prog      *program
+	cacheSize int
+	caches    sync.Pool
+}
+
+// dfaCache holds the states of a DFA and the scratch space for making more
+type dfaCache struct {
+	states map[string]*dstate
+	start  *dstate
+	stack  []int
+	seen   []bool
+	key    []byte
+}
+
+// newDFA returns a DFA for prog, or nil if it has an assertion that cannot be
+// told from the characters either side, which is only \Z
+func newDFA(prog *program) *dfa {
+	for _, i := range prog.insts {
+		if a, ok := i.assert.(*anchorMatchPoint); ok && a.kind == textEndNewline {
+			return nil
+		}
+	}
+	d := &dfa{prog: prog, cacheSize: defaultCacheSize}
+	d.caches.New = func() any {
+		return &dfaCache{
+			states: map[string]*dstate{},
+			seen:   make([]bool, len(prog.insts)),
+		}
+	}
+	return d
+}
+
+// matchLine reports whether the program matches anywhere in line, with ok
+// false if the cache was thrashing and it gave up
+func (d *dfa) matchLine(line []byte) (matched bool, ok bool) {
+	c := d.caches.Get().(*dfaCache)
+	defer d.caches.Put(c)
+
+	if c.start == nil {
+		var insts []int
+		if d.prog.anchored {
+			insts = []int{0}
+		}
+		c.start = d.state(c, insts, kindEdge)
+	}
+	s := c.start
+	resets, made := 0, 0
+	for ldx := 0; ldx < len(line); {
+		// the state with no instructions left is the one to start afresh
+		// from, at the next place the prefix turns up
+		if len(s.insts) == 0 && d.prog.prefix != nil {
+			if ldx = d.prog.skip(line, ldx); ldx < 0 {
+				return false, true
+			}
+			s = d.state(c, nil, d.kindBefore(line, ldx))
+		}
+		b := line[ldx]
+		next := s.next[b]
+		r, size := rune(b), 1
+		if d.prog.utf8 && b >= utf8.RuneSelf {
+			r, size = utf8.DecodeRune(line[ldx:])
+			next = nil
+			if r < 256 {
+				next = s.next[r]
+			} else {
+				next = s.wide[r]
+			}
+		}
+		if next == nil {
+			if len(c.states) >= d.cacheSize {
+				if resets >= maxCacheResets && ldx < made*minBytesPerState {
+					return false, false
+				}
+				debugf("DFA cache full after %d bytes\n", ldx)
+				resets++
+				clear(c.states)
+				c.start = nil
+				s = d.state(c, s.insts, s.before)
+			}
+			next = d.step(c, s, r)
+			made++
+		}
+		if next.final {
+			return next == matchedState, true
+		}
+		s = next
+		ldx += size
+	}
+	if s.atEnd == 0 {
+		s.atEnd = -1
+		if _, matched := d.closure(c, s, kindEdge); matched {
+			s.atEnd = 1
+		}
+	}
+	return s.atEnd > 0, true
+}
+
+// kindBefore returns the kind of the character before ldx in line
+func (d *dfa) kindBefore(line []byte, ldx int) charKind {
+	if ldx == 0 {
+		return kindEdge
+	}
+	c := rune(line[ldx-1])
+	if d.prog.utf8 {
+		c, _ = utf8.DecodeLastRune(line[:ldx])
+	}
+	return kindOf(c, d.prog.utf8)
+}
+
+// state returns the state for threads at insts after a character of the
+// given kind, from the cache if it is there
+func (d *dfa) state(c *dfaCache, insts []int, before charKind) *dstate {
+	c.key = append(c.key[:0], byte(before))
+	for _, pc := range insts {
+		c.key = binary.AppendUvarint(c.key, uint64(pc))
+	}
+	if s, ok := c.states[string(c.key)]; ok {
+		return s
+	}
+	s := &dstate{insts: slices.Clone(insts), before: before}
+	c.states[string(c.key)] = s
+	return s
+}
+
+// step works out and caches the state after s uses up the character r
+func (d *dfa) step(c *dfaCache, s *dstate, r rune) *dstate {
+	after := kindOf(r, d.prog.utf8)
+	next := matchedState
+	if chars, matched := d.closure(c, s, after); !matched {
+		var insts []int
+		for _, pc := range chars {
+			if d.prog.insts[pc].class.matchChar(r) {
+				insts = append(insts, pc+1)
+			}
+		}
+		slices.Sort(insts)
+		insts = slices.Compact(insts)
+		if len(insts) == 0 && d.prog.anchored {
+			next = deadState
+		} else {
+			next = d.state(c, insts, after)
+		}
+	}
+	if r < 256 {
+		s.next[r] = next
+	} else {
+		if s.wide == nil {
+			s.wide = map[rune]*dstate{}
+		}
+		s.wide[r] = next
+	}
+	return next
+}
+
+// closure follows the instructions that use up nothing from those of s,
+// with a character of the given kind next, returning the opChars it reaches
+// or whether it reached opMatch
+func (d *dfa) closure(c *dfaCache, s *dstate, after charKind) (chars []int, matched bool) {
+	clear(c.seen)
+	todo := c.stack[:0]
+	defer func() { c.stack = todo[:0] }()
+	// a new thread starts at every character of an unanchored pattern
+	if !d.prog.anchored {
+		todo = append(todo, 0)
+	}
+	todo = append(todo, s.insts...)
+	for len(todo) > 0 {
+		pc := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		if c.seen[pc] {
+			continue
+		}
+		c.seen[pc] = true
+		i := d.prog.insts[pc]
+		switch i.op {
+		case opChar:
+			chars = append(chars, pc)
+		case opMatch:
+			return nil, true
+		case opJump:
+			todo = append(todo, i.x)
+		case opSplit:
+			todo = append(todo, i.x, i.y)
+		case opSave:
+			todo = append(todo, pc+1)
+		case opEmpty:
+			// either way leads on to what follows the repeat
+			todo = append(todo, pc+1, i.y)
+		case opAssert:
+			if between(i.assert, s.before, after) {
+				todo = append(todo, pc+1)
+			}
+		}
+	}
+	return chars, false
+}
+
+// between reports whether an assertion holds between characters of the
+// given kinds
+func between(a assertion, before, after charKind) bool {
+	switch a := a.(type) {
+	case *anchorMatchPoint:
+		switch a.kind {
+		case textStart:
+			return before == kindEdge
+		case textEnd:
+			return after == kindEdge
+		case lineStart:
+			return before == kindEdge || before == kindNewline
+		case lineEnd:
+			return after == kindEdge || after == kindNewline
+		}
+	case *wordBoundaryMatchPoint:
+		return (before == kindWord) != (after == kindWord) != a.negated
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package regexp
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDFASelected(t *testing.T) {
+	for pattern, dfa := range map[string]bool{
+		"abc":        true,
+		"^(a|b)*$":   true,
+		"(?m)^x$":    true,
+		"\\bcat\\B":  true,
+		"cat\\Z":     false,
+		"(a)\\1":     false,
+		"a(?!b)":     false,
+		"(?<=a)b":    false,
+		"(a*)*(b+)?": true,
+	} {
+		if got := MustCompile(pattern).dfa != nil; got != dfa {
+			t.Errorf("/%s/ uses the DFA = %v; want %v", pattern, got, dfa)
+		}
+	}
+}
+
+// TestDFAAgrees checks the DFA against the Pike VM, with the usual cache and
+// with one so small it is emptied on every other character
+func TestDFAAgrees(t *testing.T) {
+	type input struct {
+		RegexInput
+		opts CompileOptions
+	}
+	var inputs []input
+	for _, tt := range tests {
+		inputs = append(inputs, input{tt, CompileOptions{}})
+	}
+	for _, tt := range utf8Tests {
+		inputs = append(inputs, input{tt, CompileOptions{UTF8: true}})
+	}
+	for _, tt := range propertyTests {
+		inputs = append(inputs, input{tt, CompileOptions{UTF8: true}})
+	}
+	for _, tt := range anchorFindTests {
+		inputs = append(inputs, input{RegexInput{name: tt.name, line: tt.line, pattern: tt.pattern}, CompileOptions{}})
+	}
+	for _, tt := range inputs {
+		t.Run(tt.name, func(t *testing.T) {
+			regex, err := CompileWithOptions(tt.pattern, tt.opts)
+			if err != nil {
+				t.Fatalf("CompileWithOptions(%q) = %v", tt.pattern, err)
+			}
+			if regex.dfa == nil {
+				t.Skip("no DFA")
+			}
+			line := []byte(tt.line)
+			want := regex.prog.match(line, 0) != nil
+			if got, ok := regex.dfa.matchLine(line); !ok || got != want {
+				t.Errorf("matchLine(%q) with /%s/ = %v, %v; want %v, true", tt.line, tt.pattern, got, ok, want)
+			}
+			small := newDFA(regex.prog)
+			small.cacheSize = 2
+			if got, ok := small.matchLine(line); ok && got != want {
+				t.Errorf("matchLine(%q) with /%s/ and a small cache = %v; want %v", tt.line, tt.pattern, got, want)
+			}
+		})
+	}
+}
+
+func TestDFAFallback(t *testing.T) {
+	// the tenth character from the end has to be an a, which takes a state
+	// for each of the 1024 ways the last ten characters could go
+	regex := MustCompile("a(a|b){9}$")
+	var line []byte
+	for n := uint32(1); len(line) < 10000; n = n*1103515245 + 12345 {
+		line = append(line, "ab"[n>>16&1])
+	}
+	matching := append(slices.Clone(line), "abbbbbbbbb"...)
+	line = append(line, "bbbbbbbbbb"...)
+
+	if got, ok := regex.dfa.matchLine(line); !ok || got {
+		t.Errorf("matchLine = %v, %v; want false, true", got, ok)
+	}
+	regex.dfa = newDFA(regex.prog)
+	regex.dfa.cacheSize = 64
+	if _, ok := regex.dfa.matchLine(line); ok {
+		t.Errorf("matchLine with a small cache did not give up")
+	}
+	if regex.MatchLine(line) {
+		t.Errorf("MatchLine = true after falling back to the Pike VM; want false")
+	}
+	if !regex.MatchLine(matching) {
+		t.Errorf("MatchLine = false after falling back to the Pike VM; want true")
+	}
+}
+
+func BenchmarkMatchLine(b *testing.B) {
+	line := []byte(strings.Repeat("2024-05-01 12:00:00 INFO request served in 12ms ", 1000))
+	for _, pattern := range []string{"ERROR|WARN", "(\\d+)ms timeout", "\\b(GET|POST) /api/\\w+"} {
+		regex := MustCompile("(" + pattern + ")")
+		b.Run(pattern, func(b *testing.B) {
+			b.SetBytes(int64(len(line)))
+			for i := 0; i < b.N; i++ {
+				if regex.MatchLine(line) {
+					b.Fatal("matched")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package regexp
+
+import "slices"
+
+///////////////////////////////////////////////////////////
+// Finding where in a line the pattern matches
+
+// FindIndex returns the start and end offsets of the leftmost match in b,
+// or nil if there is no match
+func (re *RegExp) FindIndex(b []byte) []int {
+	loc := re.match(b, 0)
+	if loc == nil {
+		return nil
+	}
+	return loc[0:2]
+}
+
+// Find returns the text of the leftmost match in b, or nil if there is no
+// match
+func (re *RegExp) Find(b []byte) []byte {
+	loc := re.match(b, 0)
+	if loc == nil {
+		return nil
+	}
+	return b[loc[0]:loc[1]:loc[1]]
+}
+
+// FindAllIndex returns the offsets of successive non-overlapping matches in
+// b, at most n of them (all of them if n < 0), or nil if there are none
+func (re *RegExp) FindAllIndex(b []byte, n int) [][]int {
+	var result [][]int
+	re.allMatches(b, n, func(loc []int) {
+		result = append(result, loc[0:2])
+	})
+	return result
+}
+
+// FindAll returns the text of successive non-overlapping matches in b, at
+// most n of them (all of them if n < 0), or nil if there are none
+func (re *RegExp) FindAll(b []byte, n int) [][]byte {
+	var result [][]byte
+	re.allMatches(b, n, func(loc []int) {
+		result = append(result, b[loc[0]:loc[1]:loc[1]])
+	})
+	return result
+}
+
+// allMatches calls deliver with each successive match in b. After an empty
+// match the search moves on a character so it cannot match there again, and
+// an empty match straight after the previous match is skipped: "a*" finds
+// "", "aaa" and "" in "baaac", not another "" between "aaa" and "c".
+func (re *RegExp) allMatches(b []byte, n int, deliver func([]int)) {
+	if n < 0 {
+		n = len(b) + 1
+	}
+	prevEnd := -1
+	for pos, i := 0, 0; i < n && pos <= len(b); {
+		loc := re.match(b, pos)
+		if loc == nil {
+			break
+		}
+		accept := true
+		if loc[1] == loc[0] {
+			if loc[0] == prevEnd {
+				accept = false
+			}
+			pos = re.advance(b, loc[1])
+		} else {
+			pos = loc[1]
+		}
+		prevEnd = loc[1]
+		if accept {
+			deliver(loc)
+			i++
+		}
+	}
+}
+
+///////////////////////////////////////////////////////////
+// Reading back what each group captured
+
+// NumSubexp returns the number of capture groups in the pattern
+func (re *RegExp) NumSubexp() int {
+	return re.numGroups
+}
+
+// SubexpNames returns the name of each group, with "" for unnamed groups.
+// Index 0 stands for the whole match and is always "".
+func (re *RegExp) SubexpNames() []string {
+	return re.subexpNames
+}
+
+// SubexpIndex returns the number of the group with the given name, or -1 if
+// there is no such group
+func (re *RegExp) SubexpIndex(name string) int {
+	if name == "" {
+		return -1
+	}
+	return slices.Index(re.subexpNames, name)
+}
+
+// FindSubmatchIndex returns the offsets of the leftmost match in b followed
+// by those of each group, as pairs of start and end. A group that took no
+// part in the match has offsets of -1. Returns nil if there is no match.
+func (re *RegExp) FindSubmatchIndex(b []byte) []int {
+	return re.match(b, 0)
+}
+
+// FindSubmatch returns the text of the leftmost match in b followed by the
+// text of each group, with nil for groups that took no part in the match.
+// Returns nil if there is no match.
+func (re *RegExp) FindSubmatch(b []byte) [][]byte {
+	loc := re.match(b, 0)
+	if loc == nil {
+		return nil
+	}
+	return submatches(b, loc)
+}
+
+// FindAllSubmatchIndex is the 'All' version of FindSubmatchIndex, returning
+// at most n matches (all of them if n < 0)
+func (re *RegExp) FindAllSubmatchIndex(b []byte, n int) [][]int {
+	var result [][]int
+	re.allMatches(b, n, func(loc []int) {
+		result = append(result, loc)
+	})
+	return result
+}
+
+// FindAllSubmatch is the 'All' version of FindSubmatch, returning at most
+// n matches (all of them if n < 0)
+func (re *RegExp) FindAllSubmatch(b []byte, n int) [][][]byte {
+	var result [][][]byte
+	re.allMatches(b, n, func(loc []int) {
+		result = append(result, submatches(b, loc))
+	})
+	return result
+}
+
+// submatches slices out the text for each pair of offsets in loc
+func submatches(b []byte, loc []int) [][]byte {
+	result := make([][]byte, len(loc)/2)
+	for i := range result {
+		if loc[2*i] >= 0 {
+			result[i] = b[loc[2*i]:loc[2*i+1]:loc[2*i+1]]
+		}
+	}
+	return result
+}
@@ -0,0 +1,661 @@
+package regexp
+
+import (
+	"reflect"
+	"testing"
+)
+
+type FindInput struct {
+	name    string
+	line    string
+	pattern string
+	all     [][]int // offsets of every match, nil for none
+}
+
+var findTests = []FindInput{
+	{
+		name:    "literal",
+		line:    "the cat sat on the cat",
+		pattern: "cat",
+		all:     [][]int{{4, 7}, {19, 22}},
+	},
+	{
+		name:    "no_match",
+		line:    "the dog",
+		pattern: "cat",
+		all:     nil,
+	},
+	{
+		name:    "trailing_plus_is_greedy",
+		line:    "caaats",
+		pattern: "ca+",
+		all:     [][]int{{0, 4}},
+	},
+	{
+		name:    "trailing_star_is_greedy",
+		line:    "xaaay",
+		pattern: "xa*",
+		all:     [][]int{{0, 4}},
+	},
+	{
+		name:    "trailing_question_takes_the_char",
+		line:    "colour color",
+		pattern: "colou?",
+		all:     [][]int{{0, 5}, {7, 11}},
+	},
+	{
+		name:    "plus_gives_back",
+		line:    "xaa",
+		pattern: "xa+a",
+		all:     [][]int{{0, 3}},
+	},
+	{
+		name:    "plus_keeps_one",
+		line:    "xa",
+		pattern: "xa+a",
+		all:     nil,
+	},
+	{
+		name:    "group_end",
+		line:    "say hello world",
+		pattern: "(hello|hi) w",
+		all:     [][]int{{4, 11}},
+	},
+	{
+		name:    "backref_end",
+		line:    "abab cdcd",
+		pattern: "(\\w\\w)\\1",
+		all:     [][]int{{0, 4}, {5, 9}},
+	},
+	{
+		name:    "anchored",
+		line:    "aaa",
+		pattern: "^a",
+		all:     [][]int{{0, 1}},
+	},
+	{
+		name:    "dollar",
+		line:    "cat cat",
+		pattern: "cat$",
+		all:     [][]int{{4, 7}},
+	},
+	{
+		name:    "empty_matches_between",
+		line:    "baaac",
+		pattern: "a*",
+		all:     [][]int{{0, 0}, {1, 4}, {5, 5}},
+	},
+	{
+		name:    "empty_line",
+		line:    "",
+		pattern: "a*",
+		all:     [][]int{{0, 0}},
+	},
+	{
+		name:    "only_end",
+		line:    "abc",
+		pattern: "$",
+		all:     [][]int{{3, 3}},
+	},
+	{
+		name:    "counted_is_greedy",
+		line:    "aaaaa",
+		pattern: "a{2,3}",
+		all:     [][]int{{0, 3}, {3, 5}},
+	},
+	{
+		name:    "counted_group_is_greedy",
+		line:    "ababab",
+		pattern: "(ab){1,2}",
+		all:     [][]int{{0, 4}, {4, 6}},
+	},
+	{
+		name:    "lazy_plus",
+		line:    "<a><b>",
+		pattern: "<.+?>",
+		all:     [][]int{{0, 3}, {3, 6}},
+	},
+	{
+		name:    "greedy_plus_for_comparison",
+		line:    "<a><b>",
+		pattern: "<.+>",
+		all:     [][]int{{0, 6}},
+	},
+	{
+		name:    "lazy_star_in_middle",
+		line:    "xaayby",
+		pattern: "x.*?y",
+		all:     [][]int{{0, 4}},
+	},
+	{
+		name:    "lazy_star_alone_is_empty",
+		line:    "aaa",
+		pattern: "a*?",
+		all:     [][]int{{0, 0}, {1, 1}, {2, 2}, {3, 3}},
+	},
+	{
+		name:    "lazy_plus_alone_takes_one",
+		line:    "aaa",
+		pattern: "a+?",
+		all:     [][]int{{0, 1}, {1, 2}, {2, 3}},
+	},
+	{
+		name:    "lazy_question",
+		line:    "ab",
+		pattern: "ab??",
+		all:     [][]int{{0, 1}},
+	},
+	{
+		name:    "lazy_counted",
+		line:    "aaaaa",
+		pattern: "a{2,4}?",
+		all:     [][]int{{0, 2}, {2, 4}},
+	},
+	{
+		name:    "lazy_counted_must_reach_next",
+		line:    "aaab",
+		pattern: "a{1,5}?b",
+		all:     [][]int{{0, 4}},
+	},
+	{
+		name:    "lazy_group_plus",
+		line:    "ababab",
+		pattern: "(ab)+?",
+		all:     [][]int{{0, 2}, {2, 4}, {4, 6}},
+	},
+	{
+		name:    "lazy_group_star_extends",
+		line:    "xababx",
+		pattern: "x(ab)*?x",
+		all:     [][]int{{0, 6}},
+	},
+	{
+		name:    "lazy_group_counted",
+		line:    "ababab",
+		pattern: "(ab){2,3}?",
+		all:     [][]int{{0, 4}},
+	},
+	{
+		name:    "whole_words",
+		line:    "cat concat cat_ cat.",
+		pattern: "\\bcat\\b",
+		all:     [][]int{{0, 3}, {16, 19}},
+	},
+	{
+		name:    "boundaries_are_empty",
+		line:    "ab cd",
+		pattern: "\\b",
+		all:     [][]int{{0, 0}, {2, 2}, {3, 3}, {5, 5}},
+	},
+	{
+		name:    "bare_caret",
+		line:    "abc",
+		pattern: "^",
+		all:     [][]int{{0, 0}},
+	},
+}
+
+func TestFindAllIndex(t *testing.T) {
+	for _, tt := range findTests {
+		t.Run(tt.name, func(t *testing.T) {
+			regex := MustCompile(tt.pattern)
+			if got := regex.FindAllIndex([]byte(tt.line), -1); !reflect.DeepEqual(got, tt.all) {
+				t.Errorf("FindAllIndex(%q) with /%s/ = %v; want %v", tt.line, tt.pattern, got, tt.all)
+			}
+		})
+	}
+}
+
+func TestFindIndex(t *testing.T) {
+	for _, tt := range findTests {
+		t.Run(tt.name, func(t *testing.T) {
+			regex := MustCompile(tt.pattern)
+			var want []int
+			if tt.all != nil {
+				want = tt.all[0]
+			}
+			if got := regex.FindIndex([]byte(tt.line)); !reflect.DeepEqual(got, want) {
+				t.Errorf("FindIndex(%q) with /%s/ = %v; want %v", tt.line, tt.pattern, got, want)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	for _, tt := range findTests {
+		t.Run(tt.name, func(t *testing.T) {
+			regex := MustCompile(tt.pattern)
+			got := regex.Find([]byte(tt.line))
+			if tt.all == nil {
+				if got != nil {
+					t.Errorf("Find(%q) with /%s/ = %q; want nil", tt.line, tt.pattern, got)
+				}
+				return
+			}
+			want := tt.line[tt.all[0][0]:tt.all[0][1]]
+			if got == nil || string(got) != want {
+				t.Errorf("Find(%q) with /%s/ = %q; want %q", tt.line, tt.pattern, got, want)
+			}
+		})
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	regex := MustCompile("a+")
+	line := []byte("a bb aaa c aa")
+	got := regex.FindAll(line, -1)
+	want := [][]byte{[]byte("a"), []byte("aaa"), []byte("aa")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll(%q, -1) = %q; want %q", line, got, want)
+	}
+	if got := regex.FindAll(line, 2); len(got) != 2 {
+		t.Errorf("FindAll(%q, 2) returned %d matches; want 2", line, len(got))
+	}
+	if got := regex.FindAll([]byte("bbb"), -1); got != nil {
+		t.Errorf("FindAll(%q, -1) = %q; want nil", "bbb", got)
+	}
+}
+
+// utf8FindTests are searched in UTF-8 mode, where no match starts or ends
+// part way through a rune
+var utf8FindTests = []FindInput{
+	{
+		name:    "rune_offsets",
+		line:    "résumé",
+		pattern: "é",
+		all:     [][]int{{1, 3}, {6, 8}},
+	},
+	{
+		name:    "empty_matches_between_runes",
+		line:    "éa",
+		pattern: "x*",
+		all:     [][]int{{0, 0}, {2, 2}, {3, 3}},
+	},
+	{
+		name:    "lazy_single_runes",
+		line:    "日本",
+		pattern: ".+?",
+		all:     [][]int{{0, 3}, {3, 6}},
+	},
+}
+
+func TestUTF8FindAllIndex(t *testing.T) {
+	for _, tt := range utf8FindTests {
+		t.Run(tt.name, func(t *testing.T) {
+			regex, err := CompileWithOptions(tt.pattern, CompileOptions{UTF8: true})
+			if err != nil {
+				t.Fatalf("CompileWithOptions(%q) = %v", tt.pattern, err)
+			}
+			got := regex.FindAllIndex([]byte(tt.line), -1)
+			if !reflect.DeepEqual(got, tt.all) {
+				t.Errorf("FindAllIndex(%q) = %v; want %v", tt.line, got, tt.all)
+			}
+		})
+	}
+}
+
+// anchorFindTests search text that runs over several lines
+var anchorFindTests = []FindInput{
+	{
+		name:    "caret_whole_text",
+		line:    "ab\nac\n",
+		pattern: "^a.",
+		all:     [][]int{{0, 2}},
+	},
+	{
+		name:    "caret_multiline",
+		line:    "ab\nac\n",
+		pattern: "(?m)^a.",
+		all:     [][]int{{0, 2}, {3, 5}},
+	},
+	{
+		name:    "dollar_whole_text",
+		line:    "ab\ncb",
+		pattern: ".b$",
+		all:     [][]int{{3, 5}},
+	},
+	{
+		name:    "dollar_multiline",
+		line:    "ab\ncb",
+		pattern: "(?m).b$",
+		all:     [][]int{{0, 2}, {3, 5}},
+	},
+	{
+		name:    "empty_lines_multiline",
+		line:    "a\n\nb",
+		pattern: "(?m)^$",
+		all:     [][]int{{2, 2}},
+	},
+	{
+		name:    "multiline_in_flag_group",
+		line:    "x\nx\n",
+		pattern: "(?m:^x)",
+		all:     [][]int{{0, 1}, {2, 3}},
+	},
+	{
+		name:    "multiline_leaves_absolute_anchors",
+		line:    "ab\nab",
+		pattern: "(?m)(\\Aab|ab\\z)",
+		all:     [][]int{{0, 2}, {3, 5}},
+	},
+	{
+		name:    "end_before_final_newline",
+		line:    "ab\nab\n",
+		pattern: "ab\\Z",
+		all:     [][]int{{3, 5}},
+	},
+	{
+		name:    "end_not_before_final_newline",
+		line:    "ab\nab\n",
+		pattern: "ab\\z",
+		all:     nil,
+	},
+}
+
+func TestAnchorFindAllIndex(t *testing.T) {
+	for _, tt := range anchorFindTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MustCompile(tt.pattern).FindAllIndex([]byte(tt.line), -1)
+			if !reflect.DeepEqual(got, tt.all) {
+				t.Errorf("FindAllIndex(%q) with /%s/ = %v; want %v", tt.line, tt.pattern, got, tt.all)
+			}
+		})
+	}
+}
+
+type SubmatchInput struct {
+	name    string
+	line    string
+	pattern string
+	groups  []int // offsets of the match and each group, nil for no match
+}
+
+var submatchTests = []SubmatchInput{
+	{
+		name:    "no_groups",
+		line:    "xcat",
+		pattern: "cat",
+		groups:  []int{1, 4},
+	},
+	{
+		name:    "one_group",
+		line:    "the cat is a cat",
+		pattern: "the (cat) is",
+		groups:  []int{0, 10, 4, 7},
+	},
+	{
+		name:    "nested",
+		line:    "abcd",
+		pattern: "a((b)c)d",
+		groups:  []int{0, 4, 1, 3, 1, 2},
+	},
+	{
+		name:    "winning_alternative",
+		line:    "ac",
+		pattern: "a(b|c)",
+		groups:  []int{0, 2, 1, 2},
+	},
+	{
+		name:    "failed_branch_not_reported",
+		line:    "ac",
+		pattern: "(a(b)|ac)",
+		groups:  []int{0, 2, 0, 2, -1, -1},
+	},
+	{
+		name:    "backtracked_group",
+		line:    "abab!",
+		pattern: "(\\w+)(\\w)!",
+		groups:  []int{0, 5, 0, 3, 3, 4},
+	},
+	{
+		name:    "backref_uses_winning_capture",
+		line:    "xy yy",
+		pattern: "(x|y)y \\1",
+		groups:  nil,
+	},
+	{
+		name:    "backref_second_attempt",
+		line:    "xy yy y",
+		pattern: "(\\w)y \\1",
+		groups:  []int{3, 7, 3, 4},
+	},
+	{
+		name:    "no_match",
+		line:    "dog",
+		pattern: "(cat)",
+		groups:  nil,
+	},
+	{
+		name:    "counted_group_keeps_last_pass",
+		line:    "abcd",
+		pattern: "(\\w){3}",
+		groups:  []int{0, 3, 2, 3},
+	},
+	{
+		name:    "counted_group_backtracks_pass",
+		line:    "abcd!",
+		pattern: "(\\w){2,4}d",
+		groups:  []int{0, 4, 2, 3},
+	},
+	{
+		name:    "lazy_then_greedy",
+		line:    "abc123",
+		pattern: "(\\w+?)(\\d+)",
+		groups:  []int{0, 6, 0, 3, 3, 6},
+	},
+	{
+		name:    "lazy_group_leaves_rest",
+		line:    "abab",
+		pattern: "((ab)+?)(ab)*",
+		groups:  []int{0, 4, 0, 2, 0, 2, 2, 4},
+	},
+	{
+		name:    "lazy_optional_group_skipped",
+		line:    "ab",
+		pattern: "(ab)??ab",
+		groups:  []int{0, 2, -1, -1},
+	},
+	{
+		name:    "flag_group_not_numbered",
+		line:    "Abb",
+		pattern: "(?i:a)(b)\\1",
+		groups:  []int{0, 3, 1, 2},
+	},
+	{
+		name:    "repeated_flag_group",
+		line:    "xAbaBy",
+		pattern: "(?i:ab)+(y)",
+		groups:  []int{1, 6, 5, 6},
+	},
+	{
+		name:    "capture_in_lookahead",
+		line:    "abc",
+		pattern: "(?=(\\w+))\\w",
+		groups:  []int{0, 1, 0, 3},
+	},
+	{
+		name:    "capture_in_lookbehind",
+		line:    "xbcd",
+		pattern: "(?<=(a|bc))d",
+		groups:  []int{3, 4, 1, 3},
+	},
+	{
+		name:    "no_capture_in_negative_lookahead",
+		line:    "ac",
+		pattern: "(?!(a)b)(a)c",
+		groups:  []int{0, 2, -1, -1, 0, 1},
+	},
+	{
+		name:    "lookahead_capture_dropped_on_backtrack",
+		line:    "ab",
+		pattern: "((?=(a))x|ab)",
+		groups:  []int{0, 2, 0, 2, -1, -1},
+	},
+	{
+		name:    "non_capturing_not_numbered",
+		line:    "abc",
+		pattern: "(?:a(b))(c)",
+		groups:  []int{0, 3, 1, 2, 2, 3},
+	},
+	{
+		name:    "numbered_by_left_paren",
+		line:    "abcd",
+		pattern: "((a)(?:b(c)))(d)",
+		groups:  []int{0, 4, 0, 3, 0, 1, 2, 3, 3, 4},
+	},
+	{
+		name:    "repeated_non_capturing",
+		line:    "xababy",
+		pattern: "x(?:ab)+(y)",
+		groups:  []int{0, 6, 5, 6},
+	},
+	{
+		name:    "named_python",
+		line:    "user=bob",
+		pattern: "(?P<key>\\w+)=(?P<value>\\w+)",
+		groups:  []int{0, 8, 0, 4, 5, 8},
+	},
+	{
+		name:    "named_perl",
+		line:    "user=bob",
+		pattern: "(?<key>\\w+)=(\\w+)",
+		groups:  []int{0, 8, 0, 4, 5, 8},
+	},
+	{
+		name:    "named_backref",
+		line:    "say hi hi there",
+		pattern: "(?<word>\\w+) \\k<word>",
+		groups:  []int{4, 9, 4, 6},
+	},
+	{
+		name:    "named_and_numbered_backref",
+		line:    "ab-ab-ab",
+		pattern: "(?P<pair>ab)-\\k<pair>-\\1",
+		groups:  []int{0, 8, 0, 2},
+	},
+	{
+		name:    "empty_group",
+		line:    "xa",
+		pattern: "a()",
+		groups:  []int{1, 2, 2, 2},
+	},
+	{
+		name:    "empty_non_capturing_group",
+		line:    "ab",
+		pattern: "a(?:)b",
+		groups:  []int{0, 2},
+	},
+	{
+		name:    "empty_alternative_last",
+		line:    "xb",
+		pattern: "(a|)b",
+		groups:  []int{1, 2, 1, 1},
+	},
+	{
+		name:    "empty_alternative_middle",
+		line:    "bc",
+		pattern: "(a||b)c",
+		groups:  []int{0, 2, 0, 1},
+	},
+	{
+		name:    "empty_alternative_first",
+		line:    "ab",
+		pattern: "(|a)b",
+		groups:  []int{0, 2, 0, 1},
+	},
+}
+
+func TestFindSubmatchIndex(t *testing.T) {
+	for _, tt := range submatchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			regex := MustCompile(tt.pattern)
+			if got := regex.FindSubmatchIndex([]byte(tt.line)); !reflect.DeepEqual(got, tt.groups) {
+				t.Errorf("FindSubmatchIndex(%q) with /%s/ = %v; want %v", tt.line, tt.pattern, got, tt.groups)
+			}
+		})
+	}
+}
+
+func TestFindSubmatch(t *testing.T) {
+	for _, tt := range submatchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			regex := MustCompile(tt.pattern)
+			got := regex.FindSubmatch([]byte(tt.line))
+			if tt.groups == nil {
+				if got != nil {
+					t.Errorf("FindSubmatch(%q) with /%s/ = %q; want nil", tt.line, tt.pattern, got)
+				}
+				return
+			}
+			if len(got) != regex.NumSubexp()+1 {
+				t.Fatalf("FindSubmatch(%q) with /%s/ returned %d groups; want %d", tt.line, tt.pattern, len(got), regex.NumSubexp()+1)
+			}
+			for i := range got {
+				start, end := tt.groups[2*i], tt.groups[2*i+1]
+				if start < 0 {
+					if got[i] != nil {
+						t.Errorf("group %d of /%s/ = %q; want nil", i, tt.pattern, got[i])
+					}
+					continue
+				}
+				if got[i] == nil || string(got[i]) != tt.line[start:end] {
+					t.Errorf("group %d of /%s/ = %q; want %q", i, tt.pattern, got[i], tt.line[start:end])
+				}
+			}
+		})
+	}
+}
+
+func TestFindAllSubmatch(t *testing.T) {
+	regex := MustCompile("(\\w+)=(\\d+)")
+	line := []byte("a=1 bb=22 c=x dd=4")
+	got := regex.FindAllSubmatch(line, -1)
+	want := [][][]byte{
+		{[]byte("a=1"), []byte("a"), []byte("1")},
+		{[]byte("bb=22"), []byte("bb"), []byte("22")},
+		{[]byte("dd=4"), []byte("dd"), []byte("4")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAllSubmatch(%q, -1) = %q; want %q", line, got, want)
+	}
+	gotIndex := regex.FindAllSubmatchIndex(line, 1)
+	wantIndex := [][]int{{0, 3, 0, 1, 2, 3}}
+	if !reflect.DeepEqual(gotIndex, wantIndex) {
+		t.Errorf("FindAllSubmatchIndex(%q, 1) = %v; want %v", line, gotIndex, wantIndex)
+	}
+}
+
+func TestNumSubexp(t *testing.T) {
+	for pattern, want := range map[string]int{
+		"abc":         0,
+		"(a)(b)":      2,
+		"((a|b)c)d":   2,
+		"x(a(b(c)))y": 3,
+		"(?:a)(b)":    1,
+		"(?i:a)(?:b)": 0,
+		"(?:(?:a))":   0,
+		"(?=(a))(b)":  2,
+	} {
+		if got := MustCompile(pattern).NumSubexp(); got != want {
+			t.Errorf("NumSubexp() of /%s/ = %d; want %d", pattern, got, want)
+		}
+	}
+}
+
+func TestSubexpNames(t *testing.T) {
+	regex := MustCompile("(?P<year>\\d\\d\\d\\d)-(\\d\\d)-(?<day>\\d\\d)")
+	want := []string{"", "year", "", "day"}
+	if got := regex.SubexpNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SubexpNames() = %q; want %q", got, want)
+	}
+	for name, index := range map[string]int{"year": 1, "day": 3, "month": -1, "": -1} {
+		if got := regex.SubexpIndex(name); got != index {
+			t.Errorf("SubexpIndex(%q) = %d; want %d", name, got, index)
+		}
+	}
+	loc := regex.FindSubmatchIndex([]byte("on 2024-06-30"))
+	day := regex.SubexpIndex("day")
+	if got := "on 2024-06-30"[loc[2*day]:loc[2*day+1]]; got != "30" {
+		t.Errorf("day = %q; want %q", got, "30")
+	}
+}
@@ -0,0 +1,259 @@
+package regexp
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/grep-starter-go/cmd/mygrep/ahocorasick"
+	"github.com/codecrafters-io/grep-starter-go/cmd/mygrep/regexp/syntax"
+)
+
+///////////////////////////////////////////////////////////
+// Literals every match has to contain
+
+// Most patterns people search logs with have some plain text in them that
+// every match has to contain, like ERROR in \d+ ERROR .*timeout. Looking for
+// that with bytes.Index is far quicker than running the pattern, and rules
+// out most lines without running it at all. When every match starts with the
+// text, the engines also skip straight to where it next turns up.
+
+// prefilter holds the literals found in a pattern
+type prefilter struct {
+	required []byte // the longest literal every match contains
+	prefix   []byte // a literal every match starts with, nil if there is none
+}
+
+// newPrefilter finds the literals in the parsed pattern, returning nil if
+// there are none
+func newPrefilter(mps matchPoint, utf8Mode bool) *prefilter {
+	s := &literalScan{utf8: utf8Mode, atStart: true}
+	s.chain(mps, nil)
+	s.cut()
+	if len(s.runs) == 0 {
+		return nil
+	}
+	p := &prefilter{prefix: s.prefix}
+	for _, run := range s.runs {
+		if len(run) > len(p.required) {
+			p.required = run
+		}
+	}
+	debugf("prefilter required='%s' prefix='%s'\n", p.required, p.prefix)
+	return p
+}
+
+// reject reports whether line cannot match because it lacks the required
+// literal
+func (p *prefilter) reject(line []byte) bool {
+	return index(line, p.required) < 0
+}
+
+// next returns the offset of the first place at or after pos that a match
+// could start, or -1 if there is none
+func (p *prefilter) next(line []byte, pos int) int {
+	if p.prefix == nil {
+		return pos
+	}
+	i := index(line[pos:], p.prefix)
+	if i < 0 {
+		return -1
+	}
+	return pos + i
+}
+
+// index is bytes.Index, using the quicker bytes.IndexByte for one byte
+func index(s []byte, sep []byte) int {
+	if len(sep) == 1 {
+		return bytes.IndexByte(s, sep[0])
+	}
+	return bytes.Index(s, sep)
+}
+
+// alternation is a pattern that is nothing but a group of literals, like
+// (foo|bar|baz), which Aho-Corasick finds however many of them there are
+type alternation struct {
+	matcher *ahocorasick.Matcher
+	capture bool // the pattern is group 1
+}
+
+// newAlternation returns the alternation the parsed pattern is, or nil if
+// it is anything else
+func newAlternation(tree syntax.Node, utf8Mode bool) *alternation {
+	a := &alternation{}
+	if g, ok := tree.(*syntax.Group); ok {
+		tree, a.capture = g.Sub, true
+	}
+	alt, ok := tree.(*syntax.Alternate)
+	if !ok {
+		return nil
+	}
+	s := &literalScan{utf8: utf8Mode}
+	literals := make([][]byte, len(alt.Subs))
+	for i, sub := range alt.Subs {
+		chars := []syntax.Node{sub}
+		if c, ok := sub.(*syntax.Concat); ok {
+			chars = c.Subs
+		}
+		for _, n := range chars {
+			mp, ok := (&builder{utf8: utf8Mode}).char(n)
+			if !ok {
+				return nil
+			}
+			c, ok := s.literalChar(mp)
+			if !ok {
+				return nil
+			}
+			literals[i] = s.appendChar(literals[i], c)
+		}
+		// an empty alternative matches anywhere, leaving nothing to look for
+		if len(literals[i]) == 0 {
+			return nil
+		}
+	}
+	debugf("alternation of %d literals\n", len(literals))
+	a.matcher = ahocorasick.New(literals, ahocorasick.Options{})
+	return a
+}
+
+// match finds the leftmost match in line that starts at or after pos, in
+// the same form as RegExp.match
+func (a *alternation) match(line []byte, pos int) []int {
+	found, ok := a.matcher.Find(line[pos:])
+	if !ok {
+		return nil
+	}
+	start, end := pos+found.Start, pos+found.End
+	if a.capture {
+		return []int{start, end, start, end}
+	}
+	return []int{start, end}
+}
+
+// literalScan walks a pattern collecting the runs of literal characters
+// that every match has to go through one after the other
+type literalScan struct {
+	utf8    bool
+	runs    [][]byte
+	current []byte
+	atStart bool   // nothing has been used up before current
+	prefix  []byte // the first run, if it started the pattern
+}
+
+// chain scans the matchPoints from mp up to stop
+func (s *literalScan) chain(mp matchPoint, stop matchPoint) {
+	for mp != nil && mp != stop {
+		switch p := mp.(type) {
+		case *basicMatchPoint:
+			s.counted(p, 1, 1)
+			mp = p.next
+		case *zeroOrOneMatchPoint:
+			s.counted(&p.basicMatchPoint, 0, 1)
+			mp = p.next
+		case *oneOrMoreMatchPoint:
+			s.counted(&p.basicMatchPoint, 1, -1)
+			mp = p.next
+		case *zeroOrMoreMatchPoint:
+			s.counted(&p.basicMatchPoint, 0, -1)
+			mp = p.next
+		case *countedMatchPoint:
+			s.counted(&p.basicMatchPoint, p.min, p.max)
+			mp = p.next
+		case *groupHead:
+			// only a group with one alternative has to be gone through
+			if len(p.heads) == 1 {
+				s.chain(p.heads[0], p.tail)
+			} else {
+				s.cut()
+			}
+			mp = p.tail.next
+		case *groupRepeatHead:
+			// the first pass has to follow on from what came before, but
+			// what follows the last pass could come after any of it
+			if p.min > 0 && len(p.heads) == 1 {
+				s.chain(p.heads[0], p.tail)
+			}
+			s.cut()
+			mp = p.tail.next
+		case *anchorMatchPoint:
+			// assertions use up nothing, so the characters either side
+			// still have to be next to each other
+			mp = p.next
+		case *wordBoundaryMatchPoint:
+			mp = p.next
+		case *lookaroundMatchPoint:
+			mp = p.next
+		case *backrefPoint:
+			s.cut()
+			mp = p.next
+		default:
+			// anything else ends the scan, leaving what was found so far
+			s.cut()
+			return
+		}
+	}
+}
+
+// counted scans a character matched between min and max times
+func (s *literalScan) counted(mp *basicMatchPoint, min, max int) {
+	c, ok := s.literalChar(mp)
+	if !ok || min == 0 {
+		s.cut()
+		return
+	}
+	for i := 0; i < min; i++ {
+		s.current = s.appendChar(s.current, c)
+	}
+	if max != min {
+		// the run can go on further, but it still ends with min of them
+		s.cut()
+		for i := 0; i < min; i++ {
+			s.current = s.appendChar(s.current, c)
+		}
+	}
+}
+
+// cut ends the current run, where something other than a literal comes
+func (s *literalScan) cut() {
+	if len(s.current) > 0 {
+		s.runs = append(s.runs, s.current)
+		if s.atStart {
+			s.prefix = s.current
+		}
+	}
+	s.current = nil
+	s.atStart = false
+}
+
+// literalChar returns the one character mp matches, if it only matches one
+func (s *literalScan) literalChar(mp *basicMatchPoint) (rune, bool) {
+	if mp.inverted {
+		return 0, false
+	}
+	var c rune
+	switch {
+	case len(mp.ranges) == 0 && mp.matchChars != "":
+		var size int
+		c, size = utf8.DecodeRuneInString(mp.matchChars)
+		if size != len(mp.matchChars) {
+			return 0, false
+		}
+	case len(mp.ranges) == 1 && mp.matchChars == "" && mp.ranges[0].Lo == mp.ranges[0].Hi:
+		c = mp.ranges[0].Lo
+	default:
+		return 0, false
+	}
+	// in UTF-8 mode U+FFFD also matches each byte of invalid UTF-8, which
+	// bytes.Index would not find
+	if s.utf8 && c == utf8.RuneError {
+		return 0, false
+	}
+	return c, true
+}
+
+// appendChar appends c as it appears in the line
+func (s *literalScan) appendChar(b []byte, c rune) []byte {
+	if s.utf8 {
+		return utf8.AppendRune(b, c)
+	}
+	return append(b, byte(c))
+}
@@ -0,0 +1,225 @@
+package regexp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrefilterLiterals(t *testing.T) {
+	for _, tt := range []struct {
+		pattern  string
+		opts     CompileOptions
+		required string
+		prefix   string
+	}{
+		{pattern: "\\d+ ERROR .*timeout", required: " ERROR ", prefix: ""},
+		{pattern: "cat", required: "cat", prefix: "cat"},
+		{pattern: "foo\\d+", required: "foo", prefix: "foo"},
+		{pattern: "a+b", required: "ab", prefix: "a"},
+		{pattern: "x{3}y", required: "xxxy", prefix: "xxxy"},
+		{pattern: "x{2,}yz", required: "xxyz", prefix: "xx"},
+		{pattern: "x(ab)+y", required: "xab", prefix: "xab"},
+		{pattern: "(ab)*cd", required: "cd", prefix: ""},
+		{pattern: "(?:abc|xyz)e", required: "e", prefix: ""},
+		{pattern: "(?:abc|abd)e", required: "ab", prefix: "ab"},
+		{pattern: "\\bfoo\\b", required: "foo", prefix: "foo"},
+		{pattern: "^foo$", required: "foo", prefix: "foo"},
+		{pattern: "a?bc", required: "bc", prefix: ""},
+		{pattern: "(\\w+) is \\1", required: " is ", prefix: ""},
+		{pattern: "[x]yz", required: "xyz", prefix: "xyz"},
+		{pattern: "café", opts: CompileOptions{UTF8: true}, required: "café", prefix: "café"},
+		{pattern: "1(?i)2x", required: "12", prefix: "12"},
+		{pattern: "(?i)abc", required: "", prefix: ""},
+		{pattern: "\\d+", required: "", prefix: ""},
+	} {
+		regex, err := CompileWithOptions(tt.pattern, tt.opts)
+		if err != nil {
+			t.Fatalf("CompileWithOptions(%q) = %v", tt.pattern, err)
+		}
+		var required, prefix string
+		if regex.prefilter != nil {
+			required, prefix = string(regex.prefilter.required), string(regex.prefilter.prefix)
+		}
+		if required != tt.required || prefix != tt.prefix {
+			t.Errorf("/%s/ literals = %q, prefix %q; want %q, prefix %q", tt.pattern, required, prefix, tt.required, tt.prefix)
+		}
+	}
+}
+
+// TestPrefilterAgrees runs the tables with and without the prefilter
+func TestPrefilterAgrees(t *testing.T) {
+	for _, tt := range submatchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			regex := MustCompile(tt.pattern)
+			if regex.prefilter == nil {
+				t.Skip("no literals")
+			}
+			plain := MustCompile(tt.pattern)
+			plain.prefilter = nil
+			if plain.prog != nil {
+				plain.prog.prefix = nil
+			}
+			line := []byte(tt.line)
+			for _, re := range []*RegExp{regex, backtracking(regex)} {
+				got := re.FindAllSubmatchIndex(line, -1)
+				want := plain.FindAllSubmatchIndex(line, -1)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("FindAllSubmatchIndex(%q) with /%s/ = %v; want %v", tt.line, tt.pattern, got, want)
+				}
+			}
+			if got, want := regex.MatchLine(line), plain.MatchLine(line); got != want {
+				t.Errorf("MatchLine(%q) with /%s/ = %v; want %v", tt.line, tt.pattern, got, want)
+			}
+		})
+	}
+}
+
+func TestPrefilterSkipsAhead(t *testing.T) {
+	// the word boundary before the prefix has to be judged by the character
+	// skipped over, not the one before the skip
+	for _, tt := range []RegexInput{
+		{pattern: "\\bcat", line: "cat", expected: true},
+		{pattern: "\\bcat", line: "concat", expected: false},
+		{pattern: "\\bcat", line: "con cat", expected: true},
+		{pattern: "\\Bcat", line: "cat concat", expected: true},
+		{pattern: "(?m)^cat", line: "dog\ncat", expected: true},
+		{pattern: "(?m)^cat", line: "dog cat", expected: false},
+		{pattern: "cat\\d", line: "cat catx cat7", expected: true},
+		{pattern: "cat\\d", line: "cat catx cat", expected: false},
+		{pattern: "cat\\d", line: "cat7", expected: true},
+		{pattern: "née", line: "née née", expected: true},
+	} {
+		regex, err := CompileWithOptions(tt.pattern, CompileOptions{UTF8: true})
+		if err != nil {
+			t.Fatalf("CompileWithOptions(%q) = %v", tt.pattern, err)
+		}
+		for _, re := range []*RegExp{regex, backtracking(regex)} {
+			if got := re.MatchLine([]byte(tt.line)); got != tt.expected {
+				t.Errorf("%q ~ /%s/ = %v; want %v", tt.line, tt.pattern, got, tt.expected)
+			}
+		}
+	}
+}
+
+// skipTests have the Pike VM skip ahead to the prefix after trying a place
+// where the pattern got no further than an assertion
+var skipTests = []SubmatchInput{
+	{
+		name:    "at_start",
+		line:    "foo bar",
+		pattern: "(\\bfoo)+\\b",
+		groups:  []int{0, 3, 0, 3},
+	},
+	{
+		name:    "repeated_group",
+		line:    "foobar foo",
+		pattern: "(\\bfoo)+\\b",
+		groups:  []int{7, 10, 7, 10},
+	},
+	{
+		name:    "repeated_char",
+		line:    "ab a",
+		pattern: "(\\ba)+\\b",
+		groups:  []int{3, 4, 3, 4},
+	},
+	{
+		name:    "repeated_non_capturing",
+		line:    "ab a",
+		pattern: "(?:\\ba)+\\b",
+		groups:  []int{3, 4},
+	},
+}
+
+func TestPrefilterSkipsToAssertion(t *testing.T) {
+	for _, tt := range skipTests {
+		t.Run(tt.name, func(t *testing.T) {
+			regex := MustCompile(tt.pattern)
+			line := []byte(tt.line)
+			for _, re := range []*RegExp{regex, backtracking(regex)} {
+				if got := re.FindSubmatchIndex(line); !reflect.DeepEqual(got, tt.groups) {
+					t.Errorf("FindSubmatchIndex(%q) with /%s/ = %v; want %v", tt.line, tt.pattern, got, tt.groups)
+				}
+				if got := re.MatchLine(line); got != (tt.groups != nil) {
+					t.Errorf("MatchLine(%q) with /%s/ = %v; want %v", tt.line, tt.pattern, got, tt.groups != nil)
+				}
+			}
+		})
+	}
+}
+
+func TestLiteralAlternation(t *testing.T) {
+	for pattern, literals := range map[string]bool{
+		"(foo|bar|baz)":    true,
+		"(?:foo|bar|baz)":  true,
+		"(?P<w>cat|dog)":   true,
+		"(a|b|c)":          true,
+		"(foo|bar)x":       false,
+		"x(foo|bar)":       false,
+		"(foo|ba?r)":       false,
+		"(foo)":            false,
+		"(?i:foo|bar)":     false,
+		"(foo|bar|[bc]az)": false,
+		"(foo|)":           false,
+		"(|foo|bar)":       false,
+	} {
+		if got := MustCompile(pattern).alternation != nil; got != literals {
+			t.Errorf("/%s/ is an alternation of literals = %v; want %v", pattern, got, literals)
+		}
+	}
+}
+
+var alternationTests = []SubmatchInput{
+	{
+		name:    "which_literal",
+		line:    "a bar then a foo",
+		pattern: "(foo|bar|baz)",
+		groups:  []int{2, 5, 2, 5},
+	},
+	{
+		name:    "first_alternative_wins",
+		line:    "xabc",
+		pattern: "(ab|abc)",
+		groups:  []int{1, 3, 1, 3},
+	},
+	{
+		name:    "leftmost_wins",
+		line:    "xabcd",
+		pattern: "(bcd|abc)",
+		groups:  []int{1, 4, 1, 4},
+	},
+	{
+		name:    "non_capturing",
+		line:    "xabc",
+		pattern: "(?:bc|ab)",
+		groups:  []int{1, 3},
+	},
+	{
+		name:    "no_match",
+		line:    "xyz",
+		pattern: "(foo|bar)",
+		groups:  nil,
+	},
+}
+
+func TestAlternationAgrees(t *testing.T) {
+	for _, tt := range alternationTests {
+		t.Run(tt.name, func(t *testing.T) {
+			regex := MustCompile(tt.pattern)
+			if regex.alternation == nil {
+				t.Fatalf("/%s/ is not an alternation of literals", tt.pattern)
+			}
+			line := []byte(tt.line)
+			if got := regex.FindSubmatchIndex(line); !reflect.DeepEqual(got, tt.groups) {
+				t.Errorf("FindSubmatchIndex(%q) with /%s/ = %v; want %v", tt.line, tt.pattern, got, tt.groups)
+			}
+			plain := MustCompile(tt.pattern)
+			plain.alternation = nil
+			if got, want := regex.FindAllSubmatchIndex(line, -1), plain.FindAllSubmatchIndex(line, -1); !reflect.DeepEqual(got, want) {
+				t.Errorf("FindAllSubmatchIndex(%q) with /%s/ = %v; the Pike VM gives %v", tt.line, tt.pattern, got, want)
+			}
+			if got := regex.MatchLine(line); got != (tt.groups != nil) {
+				t.Errorf("MatchLine(%q) with /%s/ = %v; want %v", tt.line, tt.pattern, got, tt.groups != nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package regexp
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+///////////////////////////////////////////////////////////
+// A Pike VM, which runs every way through the pattern side by side
+
+// The backtracker in regexp.go tries one way through the pattern at a time,
+// which for patterns like (a*)*b can mean exponentially many. The Pike VM
+// compiles the pattern to a program and steps a thread for each way through
+// it along the line together, dropping any thread that reaches the same
+// instruction as one ahead of it. That bounds the work at the program size
+// for each character of the line, while keeping the threads in priority
+// order gives the same leftmost match and captures as the backtracker.
+//
+// Backreferences and lookarounds need the backtracker, so patterns that use
+// them are not compiled.
+
+// instOp is what an instruction does
+type instOp uint8
+
+const (
+	opChar   instOp = iota // use up a character that class matches
+	opSplit                // carry on at x, and at y with lower priority
+	opJump                 // carry on at x
+	opSave                 // record the offset in capture slot x
+	opAssert               // carry on only if the assertion holds here
+	opEmpty                // carry on at y if the pass started at slot x was empty
+	opMatch                // the whole pattern has matched
+)
+
+type inst struct {
+	op     instOp
+	x, y   int
+	class  *basicMatchPoint
+	assert assertion
+	passes []int // slots of the checked repeat passes this is inside
+}
+
+// assertion is a matchPoint that matches without using up any of the line
+type assertion interface {
+	holds(line []byte, ldx int, utf8Mode bool) bool
+}
+
+// program is a pattern compiled for the Pike VM. Slots 0 and 1 of the
+// captures are the whole match, then each capturing group has two, and
+// after those each repeated group has one for where its current pass began.
+type program struct {
+	insts    []inst
+	numCaps  int // capture slots returned from a match
+	numSlots int
+	utf8     bool
+	anchored bool   // only try matching at the start of the line
+	prefix   []byte // a literal every match starts with, to skip ahead to
+}
+
+// errNeedsBacktracker is returned for patterns the Pike VM cannot run
+var errNeedsBacktracker = errors.New("pattern needs the backtracker")
+
+// compileProgram turns the matchPoint graph built from the parse tree into a
+// program, or returns errNeedsBacktracker
+func compileProgram(re *RegExp) (*program, error) {
+	c := &compiler{numGroups: re.numGroups, numSlots: 2 + 2*re.numGroups}
+	if err := c.chain(re.mps, nil); err != nil {
+		return nil, err
+	}
+	c.emit(inst{op: opMatch})
+	var prefix []byte
+	if re.prefilter != nil && !re.matchStart {
+		prefix = re.prefilter.prefix
+	}
+	return &program{
+		insts:    c.insts,
+		numCaps:  2 + 2*re.numGroups,
+		numSlots: c.numSlots,
+		utf8:     re.utf8,
+		anchored: re.matchStart,
+		prefix:   prefix,
+	}, nil
+}
+
+type compiler struct {
+	insts     []inst
+	numGroups int
+	numSlots  int
+	passes    []int // slots of the checked repeat passes being compiled
+}
+
+// emit adds an instruction, returning its address
+func (c *compiler) emit(i inst) int {
+	// a copy, as the passes of the next repeat go where these are now
+	i.passes = slices.Clone(c.passes)
+	c.insts = append(c.insts, i)
+	return len(c.insts) - 1
+}
+
+// chain compiles the matchPoints from mp up to stop
+func (c *compiler) chain(mp matchPoint, stop matchPoint) error {
+	for mp != nil && mp != stop {
+		var err error
+		switch p := mp.(type) {
+		case *basicMatchPoint:
+			c.emit(inst{op: opChar, class: p})
+			mp = p.next
+		case *zeroOrOneMatchPoint:
+			err = c.repeat(0, 1, false, c.char(&p.basicMatchPoint))
+			mp = p.next
+		case *oneOrMoreMatchPoint:
+			err = c.repeat(1, -1, false, c.char(&p.basicMatchPoint))
+			mp = p.next
+		case *zeroOrMoreMatchPoint:
+			err = c.repeat(0, -1, false, c.char(&p.basicMatchPoint))
+			mp = p.next
+		case *countedMatchPoint:
+			err = c.repeat(p.min, p.max, p.lazy, c.char(&p.basicMatchPoint))
+			mp = p.next
+		case *groupHead:
+			err = c.group(*p)
+			mp = p.tail.next
+		case *groupRepeatHead:
+			err = c.groupRepeat(p)
+			mp = p.tail.next
+		case *anchorMatchPoint:
+			c.emit(inst{op: opAssert, assert: p})
+			mp = p.next
+		case *wordBoundaryMatchPoint:
+			c.emit(inst{op: opAssert, assert: p})
+			mp = p.next
+		default:
+			return errNeedsBacktracker
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// char returns a function compiling a single character
+func (c *compiler) char(class *basicMatchPoint) func() error {
+	return func() error {
+		c.emit(inst{op: opChar, class: class})
+		return nil
+	}
+}
+
+// group compiles the alternatives of a group, saving where it starts and
+// ends if it captures
+func (c *compiler) group(gh groupHead) error {
+	index := gh.tail.index
+	capture := index < c.numGroups
+	if capture {
+		c.emit(inst{op: opSave, x: 2 + 2*index})
+	}
+	jumps := []int{}
+	for i, head := range gh.heads {
+		split := -1
+		if i < len(gh.heads)-1 {
+			split = c.emit(inst{op: opSplit, x: len(c.insts) + 1})
+		}
+		if err := c.chain(head, gh.tail); err != nil {
+			return err
+		}
+		if split >= 0 {
+			jumps = append(jumps, c.emit(inst{op: opJump}))
+			c.insts[split].y = len(c.insts)
+		}
+	}
+	for _, jump := range jumps {
+		c.insts[jump].x = len(c.insts)
+	}
+	if capture {
+		c.emit(inst{op: opSave, x: 2 + 2*index + 1})
+	}
+	return nil
+}
+
+// groupRepeat compiles a repeated group. Once the group has reached its
+// minimum number of passes, a pass that matched nothing ends the repeat as it
+// does in the backtracker, so each of those passes records where it started
+// in a slot of its own to check against.
+func (c *compiler) groupRepeat(gr *groupRepeatHead) error {
+	slot := c.numSlots
+	c.numSlots++
+	pass := 0
+	exits := []int{}
+	err := c.repeat(gr.min, gr.max, gr.lazy, func() error {
+		pass++
+		if pass < gr.min {
+			return c.group(gr.groupHead)
+		}
+		c.emit(inst{op: opSave, x: slot})
+		c.passes = append(c.passes, slot)
+		defer func() { c.passes = c.passes[:len(c.passes)-1] }()
+		if err := c.group(gr.groupHead); err != nil {
+			return err
+		}
+		exits = append(exits, c.emit(inst{op: opEmpty, x: slot}))
+		return nil
+	})
+	for _, exit := range exits {
+		c.insts[exit].y = len(c.insts)
+	}
+	return err
+}
+
+// repeat compiles body between min and max times (max < 0 means no limit),
+// with the splits favouring another pass unless lazy. Counted repeats are
+// written out in full, which the repeat limit keeps to a sensible size.
+func (c *compiler) repeat(min, max int, lazy bool, body func() error) error {
+	// split makes a split to at, with the other way to be filled in later
+	split := func(at int) int {
+		return c.emit(inst{op: opSplit, x: at})
+	}
+	// other fills in the lower priority way out of a split, swapping the
+	// two over if lazy
+	other := func(pc int, to int) {
+		c.insts[pc].y = to
+		if lazy {
+			c.insts[pc].x, c.insts[pc].y = c.insts[pc].y, c.insts[pc].x
+		}
+	}
+
+	if max < 0 {
+		for i := 0; i < min-1; i++ {
+			if err := body(); err != nil {
+				return err
+			}
+		}
+		skip := -1
+		if min == 0 {
+			skip = split(len(c.insts) + 1)
+		}
+		loop := len(c.insts)
+		if err := body(); err != nil {
+			return err
+		}
+		again := split(loop)
+		other(again, len(c.insts))
+		if skip >= 0 {
+			other(skip, len(c.insts))
+		}
+		return nil
+	}
+
+	for i := 0; i < min; i++ {
+		if err := body(); err != nil {
+			return err
+		}
+	}
+	// each optional pass is nested in the one before: x{1,3} is x(x(x)?)?
+	skips := []int{}
+	for i := min; i < max; i++ {
+		skips = append(skips, split(len(c.insts)+1))
+		if err := body(); err != nil {
+			return err
+		}
+	}
+	for _, skip := range skips {
+		other(skip, len(c.insts))
+	}
+	return nil
+}
+
+func (p *program) String() string {
+	var b strings.Builder
+	for pc, i := range p.insts {
+		switch i.op {
+		case opChar:
+			class := *i.class
+			class.next = nil
+			fmt.Fprintf(&b, "%d: char %s\n", pc, class)
+		case opSplit:
+			fmt.Fprintf(&b, "%d: split %d, %d\n", pc, i.x, i.y)
+		case opJump:
+			fmt.Fprintf(&b, "%d: jump %d\n", pc, i.x)
+		case opSave:
+			fmt.Fprintf(&b, "%d: save %d\n", pc, i.x)
+		case opEmpty:
+			fmt.Fprintf(&b, "%d: empty %d, %d\n", pc, i.x, i.y)
+		case opAssert:
+			var kind string
+			switch a := i.assert.(type) {
+			case *anchorMatchPoint:
+				kind = anchorMatchPoint{kind: a.kind}.String()
+			case *wordBoundaryMatchPoint:
+				kind = wordBoundaryMatchPoint{negated: a.negated}.String()
+			}
+			fmt.Fprintf(&b, "%d: assert %s\n", pc, kind)
+		case opMatch:
+			fmt.Fprintf(&b, "%d: match\n", pc)
+		}
+	}
+	return b.String()
+}
+
+///////////////////////////////////////////////////////////
+// Running a program against a line
+
+// skip returns the offset of the next place at or after ldx the prefix
+// turns up, or -1 if it does not
+func (p *program) skip(line []byte, ldx int) int {
+	i := index(line[ldx:], p.prefix)
+	if i < 0 {
+		return -1
+	}
+	return ldx + i
+}
+
+// thread is one way through the program, waiting at an opChar or opMatch
+type thread struct {
+	pc   int
+	caps []int
+}
+
+// threadList holds threads in priority order, at most one per instruction
+// and set of empty passes
+type threadList struct {
+	threads []thread
+	// seen holds, by pc, which of its passes had started at the offset
+	// for each time the instruction was passed on the way to a thread
+	seen [][]uint64
+}
+
+func newThreadList(size int) *threadList {
+	return &threadList{seen: make([][]uint64, size)}
+}
+
+func (l *threadList) clear() {
+	l.threads = l.threads[:0]
+	for pc := range l.seen {
+		l.seen[pc] = l.seen[pc][:0]
+	}
+}
+
+// add follows the instructions that use up nothing from pc at ldx, adding
+// a thread for each opChar or opMatch it reaches that no earlier thread has.
+//
+// Two threads at the same instruction go the same way from then on, except
+// at an opEmpty, so the one behind is usually dropped. But a pass that ends
+// here can loop round for an empty pass through the same instructions, which
+// has to leave the repeat with its own captures, so instructions inside a
+// checked pass are only shared by threads whose passes are empty alike.
+func (p *program) add(l *threadList, pc int, ldx int, line []byte, caps []int) {
+	i := p.insts[pc]
+	var empty uint64
+	for n, slot := range i.passes {
+		if n < 64 && caps[slot] == ldx {
+			empty |= 1 << n
+		}
+	}
+	if slices.Contains(l.seen[pc], empty) {
+		return
+	}
+	l.seen[pc] = append(l.seen[pc], empty)
+	switch i.op {
+	case opJump:
+		p.add(l, i.x, ldx, line, caps)
+	case opSplit:
+		p.add(l, i.x, ldx, line, caps)
+		p.add(l, i.y, ldx, line, caps)
+	case opSave:
+		caps = slices.Clone(caps)
+		caps[i.x] = ldx
+		p.add(l, pc+1, ldx, line, caps)
+	case opAssert:
+		if i.assert.holds(line, ldx, p.utf8) {
+			p.add(l, pc+1, ldx, line, caps)
+		}
+	case opEmpty:
+		if caps[i.x] == ldx {
+			p.add(l, i.y, ldx, line, caps)
+		} else {
+			p.add(l, pc+1, ldx, line, caps)
+		}
+	default:
+		l.threads = append(l.threads, thread{pc, caps})
+	}
+}
+
+// match finds the leftmost match in line that starts at or after pos, in
+// the same form as RegExp.match
+func (p *program) match(line []byte, pos int) []int {
+	current, next := newThreadList(len(p.insts)), newThreadList(len(p.insts))
+	var matched []int
+	for ldx := pos; ; {
+		// once every thread has died, the next match cannot start before the
+		// prefix next turns up
+		if matched == nil && len(current.threads) == 0 && p.prefix != nil {
+			at := p.skip(line, ldx)
+			if at < 0 {
+				break
+			}
+			// what was passed on the way to no threads at all was passed at
+			// the old offset, and must not stop the new one
+			if at != ldx {
+				current.clear()
+			}
+			ldx = at
+		}
+		// a match starting here ranks below any that started further back
+		if matched == nil && (!p.anchored || ldx == 0) {
+			caps := make([]int, p.numSlots)
+			for i := range caps {
+				caps[i] = -1
+			}
+			caps[0] = ldx
+			p.add(current, 0, ldx, line, caps)
+		}
+		if len(current.threads) == 0 && (matched != nil || p.anchored) {
+			break
+		}
+		c, size := rune(0), 0
+		if ldx < len(line) {
+			c, size = lineChar(line, ldx, p.utf8)
+		}
+	threads:
+		for _, t := range current.threads {
+			i := p.insts[t.pc]
+			switch i.op {
+			case opMatch:
+				matched = slices.Clone(t.caps[:p.numCaps])
+				matched[1] = ldx
+				// anything after this thread ranks below the match
+				break threads
+			case opChar:
+				if size > 0 && i.class.matchChar(c) {
+					p.add(next, t.pc+1, ldx+size, line, t.caps)
+				}
+			}
+		}
+		current, next = next, current
+		next.clear()
+		if size == 0 {
+			break
+		}
+		ldx += size
+	}
+	return matched
+}
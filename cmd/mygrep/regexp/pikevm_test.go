@@ -0,0 +1,158 @@
+package regexp
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// backtracking returns a copy of regex that always uses the backtracker,
+// MatchLine and alternations of literals included
+func backtracking(regex *RegExp) *RegExp {
+	back := *regex
+	back.prog = nil
+	back.dfa = nil
+	back.alternation = nil
+	return &back
+}
+
+func TestPikeVMSelected(t *testing.T) {
+	for pattern, vm := range map[string]bool{
+		"abc":           true,
+		"(a*)*b":        true,
+		"(?i)^(\\w+)$":  true,
+		"\\bcat(s)?\\b": true,
+		"(a)\\1":        false,
+		"a(?=b)":        false,
+		"(?<!a)b":       false,
+	} {
+		if got := MustCompile(pattern).prog != nil; got != vm {
+			t.Errorf("/%s/ uses the Pike VM = %v; want %v", pattern, got, vm)
+		}
+	}
+}
+
+// TestPikeVMAgrees runs the submatch tables through both engines, which
+// must find the same matches and captures
+func TestPikeVMAgrees(t *testing.T) {
+	var inputs []SubmatchInput
+	inputs = append(inputs, submatchTests...)
+	inputs = append(inputs, groupRepeatTests...)
+	for _, tt := range findTests {
+		inputs = append(inputs, SubmatchInput{name: tt.name, line: tt.line, pattern: tt.pattern})
+	}
+	for _, tt := range tests {
+		inputs = append(inputs, SubmatchInput{name: tt.name, line: tt.line, pattern: tt.pattern})
+	}
+	for _, tt := range inputs {
+		t.Run(tt.name, func(t *testing.T) {
+			regex := MustCompile(tt.pattern)
+			if regex.prog == nil {
+				t.Skip("needs the backtracker")
+			}
+			line := []byte(tt.line)
+			got := regex.FindAllSubmatchIndex(line, -1)
+			want := backtracking(regex).FindAllSubmatchIndex(line, -1)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("FindAllSubmatchIndex(%q) with /%s/ = %v; backtracker gives %v\n%s", tt.line, tt.pattern, got, want, regex.prog)
+			}
+		})
+	}
+}
+
+// randomPattern builds a pattern of at most depth levels of groups, from a
+// few characters, assertions and every kind of repeat, so that lines of a
+// few of the same characters can match it in many ways
+func randomPattern(r *rand.Rand, depth int) string {
+	atoms := []string{"a", "b", "[ab]", ".", "\\b", "\\B", "^", "$", ""}
+	quantifiers := []string{"", "", "*", "+", "?", "{0,2}", "{1,2}", "{2}", "*?", "+?", "??", "{0,2}?"}
+	var b strings.Builder
+	for range 1 + r.IntN(3) {
+		if depth == 0 || r.IntN(3) > 0 {
+			atom := atoms[r.IntN(len(atoms))]
+			b.WriteString(atom)
+			if atom == "a" || atom == "b" || atom == "[ab]" || atom == "." {
+				b.WriteString(quantifiers[r.IntN(len(quantifiers))])
+			}
+			continue
+		}
+		if r.IntN(2) == 0 {
+			b.WriteString("(")
+		} else {
+			b.WriteString("(?:")
+		}
+		for i := range 1 + r.IntN(3) {
+			if i > 0 {
+				b.WriteString("|")
+			}
+			b.WriteString(randomPattern(r, depth-1))
+		}
+		b.WriteString(")")
+		b.WriteString(quantifiers[r.IntN(len(quantifiers))])
+	}
+	return b.String()
+}
+
+// TestPikeVMAgreesRandom runs both engines over patterns and lines made up
+// at random, from the same seed each time
+func TestPikeVMAgreesRandom(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for range 3000 {
+		pattern := randomPattern(r, 2)
+		if pattern == "" {
+			continue
+		}
+		regex, err := Compile(pattern)
+		if err != nil {
+			t.Fatalf("Compile(%q) = %v", pattern, err)
+		}
+		if regex.prog == nil {
+			t.Fatalf("/%s/ does not use the Pike VM", pattern)
+		}
+		line := make([]byte, r.IntN(8))
+		for i := range line {
+			line[i] = "ab "[r.IntN(3)]
+		}
+		got := regex.FindAllSubmatchIndex(line, -1)
+		want := backtracking(regex).FindAllSubmatchIndex(line, -1)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("FindAllSubmatchIndex(%q) with /%s/ = %v; backtracker gives %v", line, pattern, got, want)
+		}
+	}
+}
+
+// TestPikeVMLinear uses patterns that take the backtracker exponential time
+// on lines that almost match
+func TestPikeVMLinear(t *testing.T) {
+	long := strings.Repeat("a", 10000)
+	for _, tt := range []RegexInput{
+		{pattern: "(a*)*b", line: long, expected: false},
+		{pattern: "(a|a)+c", line: long, expected: false},
+		{pattern: "(a+a+)+b", line: long, expected: false},
+		{pattern: "^(a|aa)*$", line: long + "b", expected: false},
+		{pattern: "(a*)*$", line: long, expected: true},
+		{pattern: "((a?){2,5})+a$", line: long, expected: true},
+	} {
+		regex := MustCompile(tt.pattern)
+		if regex.prog == nil {
+			t.Fatalf("/%s/ does not use the Pike VM", tt.pattern)
+		}
+		if got := regex.MatchLine([]byte(tt.line)); got != tt.expected {
+			t.Errorf("MatchLine with /%s/ = %v; want %v", tt.pattern, got, tt.expected)
+		}
+	}
+}
+
+func TestProgramString(t *testing.T) {
+	want := `0: split 1, 3
+1: char basic: [a]
+2: jump 5
+3: char basic: [b]
+4: char basic: [c]
+5: match
+`
+	if got := MustCompile("(?:a|bc)").prog.String(); got != want {
+		t.Errorf("program =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -2,10 +2,14 @@ package regexp
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/grep-starter-go/cmd/mygrep/regexp/syntax"
 )
 
 ///////////////////////////////////////////////////////////
@@ -21,148 +25,360 @@ func debugf(format string, args ...interface{}) {
 	}
 }
 
+///////////////////////////////////////////////////////////
+// Errors reported when a pattern cannot be compiled
+
+// ErrorCode describes the kind of problem found in a pattern
+type ErrorCode = syntax.ErrorCode
+
+const (
+	ErrEmptyPattern      = syntax.ErrEmptyPattern
+	ErrMissingBracket    = syntax.ErrMissingBracket
+	ErrMissingParen      = syntax.ErrMissingParen
+	ErrTrailingBackslash = syntax.ErrTrailingBackslash
+	ErrInvalidBackref    = syntax.ErrInvalidBackref
+	ErrInvalidPerlOp     = syntax.ErrInvalidPerlOp
+	ErrInvalidGroupName  = syntax.ErrInvalidGroupName
+	ErrDuplicateName     = syntax.ErrDuplicateName
+	ErrInvalidRepeatSize = syntax.ErrInvalidRepeatSize
+	ErrRepeatTooLarge    = syntax.ErrRepeatTooLarge
+	ErrInvalidCharRange  = syntax.ErrInvalidCharRange
+	ErrInvalidCharClass  = syntax.ErrInvalidCharClass
+	ErrInvalidEscape     = syntax.ErrInvalidEscape
+	ErrInvalidUTF8       = syntax.ErrInvalidUTF8
+	ErrInvalidLookbehind = syntax.ErrInvalidLookbehind
+)
+
+// SyntaxError reports what is wrong with a pattern and where
+type SyntaxError = syntax.Error
+
 ///////////////////////////////////////////////////////////
 // RegExp class and constructor function for it
 
+// RegExp is a compiled pattern. Each match keeps its state in a matcher of
+// its own, so goroutines can share a RegExp.
 type RegExp struct {
-	mps        matchPoint
-	matchStart bool
-	back       []string
+	tree        syntax.Node // what the pattern parsed to
+	mps         matchPoint
+	matchStart  bool
+	numGroups   int
+	numSlots    int // groups of any kind, capturing or not
+	subexpNames []string
+	utf8        bool         // match runes rather than bytes
+	prog        *program     // for the Pike VM, nil when the pattern needs backtracking
+	dfa         *dfa         // for MatchLine, nil when prog is or the DFA cannot run it
+	prefilter   *prefilter   // nil when the pattern has no literals to look for
+	alternation *alternation // set when the pattern is only a group of literals
 }
 
+// String returns the pattern in the canonical form the syntax package
+// prints it in, which compiles to the same RegExp
 func (re RegExp) String() string {
-	return fmt.Sprintf("#[RegExp(matchStart=%v): '%s' %d]", re.matchStart, re.mps, len(re.back))
+	return re.tree.String()
 }
 
+// MatchLine reports whether the pattern matches anywhere in line, ignoring
+// any trailing newline
 func (re *RegExp) MatchLine(line []byte) bool {
 	// trim any newline off of that in case we forget -n for echo
 	line = bytes.TrimRight(line, "\n\r")
 
 	debugf("line='%s'\n", line)
-	if re.matchStart {
-		matched, _ := re.mps.matchHere(line, 0, false)
-		if matched {
-			debugf("whole matched\n")
-			return true
-		}
+	if re.alternation != nil {
+		return re.alternation.matcher.Match(line)
+	}
+	if re.prefilter != nil && re.prefilter.reject(line) {
+		debugf("required literal missing\n")
 		return false
 	}
-	for ldx := 0; ldx < len(line); ldx++ {
-		matched, _ := re.mps.matchHere(line, ldx, false)
-		if matched {
-			debugf("whole matched")
-			return true
+	if re.dfa != nil {
+		if matched, ok := re.dfa.matchLine(line); ok {
+			return matched
 		}
+		debugf("DFA cache thrashing, falling back to the Pike VM\n")
+	}
+	if re.match(line, 0) != nil {
+		debugf("whole matched\n")
+		return true
 	}
-
 	debugf("whole fails\n")
 	return false
 }
 
-func ParseRegExp(pattern string) RegExp {
-	regex := RegExp{}
-	if len(pattern) == 0 {
-		debugf("pattern must contain at least one character\n")
-		os.Exit(-3)
+// match finds the leftmost match in line that starts at or after pos. It
+// returns the start and end offsets of the whole match followed by those of
+// each group (-1 for groups that did not take part), or nil for no match.
+func (re *RegExp) match(line []byte, pos int) []int {
+	if re.alternation != nil {
+		return re.alternation.match(line, pos)
 	}
-	if pattern[0] == '^' {
-		regex.matchStart = true
-		pattern = pattern[1:]
+	if re.prefilter != nil && re.prefilter.reject(line[pos:]) {
+		return nil
+	}
+	if re.prog != nil {
+		return re.prog.match(line, pos)
+	}
+	return re.backtrack(line, pos)
+}
+
+// backtrack is match for patterns that need backreferences or lookarounds,
+// trying each way through the pattern in turn
+func (re *RegExp) backtrack(line []byte, pos int) []int {
+	m := re.newMatcher(line)
+	for ldx := pos; ldx <= len(line); ldx = re.advance(line, ldx) {
+		if re.matchStart && ldx > 0 {
+			break
+		}
+		if re.prefilter != nil {
+			if ldx = re.prefilter.next(line, ldx); ldx < 0 {
+				break
+			}
+		}
+		m.reset()
+		matched, end := m.matchNext(re.mps, ldx)
+		if matched {
+			return append([]int{ldx, end}, m.caps[:2*re.numGroups]...)
+		}
+	}
+	return nil
+}
+
+// advance returns the offset of the character after the one at ldx, which
+// in UTF-8 mode may be several bytes on
+func (re *RegExp) advance(line []byte, ldx int) int {
+	if ldx >= len(line) {
+		return ldx + 1
 	}
+	_, size := lineChar(line, ldx, re.utf8)
+	return ldx + size
+}
 
-	regex.back = []string{}
+// DefaultMaxRepeat is the repeat limit used when CompileOptions leaves it unset
+const DefaultMaxRepeat = syntax.DefaultMaxRepeat
+
+// CompileOptions adjusts how CompileWithOptions treats a pattern
+type CompileOptions struct {
+	// MaxRepeat is passed to the parser, as in syntax.Options
+	MaxRepeat int
+
+	// UTF8 treats both the pattern and the lines it is matched against as
+	// UTF-8, so that ., sets and quantifiers work on whole runes and match
+	// offsets never split one. Each byte of an invalid sequence in a line is
+	// taken as a character of its own, U+FFFD, while a pattern that is not
+	// valid UTF-8 is refused. It also widens \w, \W, \b and \B to Unicode
+	// letters, marks, digits and connecting punctuation.
+	//
+	// Without it every byte is a character, which is what binary data needs.
+	UTF8 bool
+
+	// CaseInsensitive is passed to the parser, as in syntax.Options
+	CaseInsensitive bool
+}
+
+// Compile parses pattern and returns a RegExp that can be matched against
+// lines. Malformed patterns are reported as a *SyntaxError.
+func Compile(pattern string) (*RegExp, error) {
+	return CompileWithOptions(pattern, CompileOptions{})
+}
 
-	regex.mps = parsePattern(pattern, &regex.back)
+// CompileWithOptions is like Compile but lets the caller adjust limits
+func CompileWithOptions(pattern string, opts CompileOptions) (*RegExp, error) {
+	tree, err := syntax.Parse(pattern, syntax.Options{
+		MaxRepeat:       opts.MaxRepeat,
+		UTF8:            opts.UTF8,
+		CaseInsensitive: opts.CaseInsensitive,
+	})
+	if err != nil {
+		return nil, err
+	}
+	regex := compile(syntax.Simplify(tree), opts.UTF8)
+	// simplifying takes the prefixes the literals share out of them, so they
+	// are looked for in the tree as parsed
+	regex.alternation = newAlternation(tree, opts.UTF8)
 	debugf("regex = '%+v'\n", regex)
+	return regex, nil
+}
+
+// compile builds the RegExp that runs tree
+func compile(tree syntax.Node, utf8Mode bool) *RegExp {
+	regex := &RegExp{tree: tree, utf8: utf8Mode}
+	mps, names, slots := build(tree, utf8Mode)
+	regex.mps = mps
+	// a pattern that must start at the start of the line needs trying there
+	// and nowhere else
+	if a, ok := mps.(*anchorMatchPoint); ok && a.kind == textStart {
+		regex.matchStart = true
+	}
+	regex.numGroups = len(names)
+	regex.numSlots = slots
+	regex.subexpNames = append([]string{""}, names...)
+	regex.prefilter = newPrefilter(mps, utf8Mode)
+	// the Pike VM runs in linear time, so it is used wherever it can be
+	if prog, err := compileProgram(regex); err == nil {
+		regex.prog = prog
+		regex.dfa = newDFA(prog)
+	}
 	return regex
 }
 
-// called when we are inside a [abcd] pattern
-func parseSetPattern(pattern *string, rdx *int) (*basicMatchPoint, error) {
-	retval := basicMatchPoint{}
-	inverted := false
-	if *rdx < len(*pattern) && (*pattern)[*rdx] == '^' {
-		*rdx++
-		inverted = true
-	}
-	retval.inverted = inverted
-	chars := []byte{}
-	for *rdx < len(*pattern) {
-		switch (*pattern)[*rdx] {
-		case ']':
-			retval.matchChars = string(chars[:])
-			return &retval, nil
-		default:
-			chars = append(chars, (*pattern)[*rdx])
-		}
-		(*rdx)++
+// MustCompile is like Compile but panics if the pattern cannot be parsed
+func MustCompile(pattern string) *RegExp {
+	regex, err := Compile(pattern)
+	if err != nil {
+		panic("regexp: Compile(" + quote(pattern) + "): " + err.Error())
 	}
-	return &retval, errors.New("parse pattern not closed")
+	return regex
 }
 
-const (
-	digits    = "0123456789"
-	alpha     = "abcdefghijklmnopqrstuvwxyz"
-	wordChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ" + alpha + digits + "_"
-)
+// ParseRegExp compiles pattern, panicking if it is malformed.
+//
+// Deprecated: use Compile, which reports a *SyntaxError instead.
+func ParseRegExp(pattern string) RegExp {
+	return *MustCompile(pattern)
+}
 
-type groupHead struct {
-	heads []matchPoint
-	tails []matchPoint
-	tail  *groupTail
+func quote(s string) string {
+	if strconv.CanBackquote(s) {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
 }
 
-type groupOneOrMoreHead struct {
-	groupHead
+// lineChar decodes the character of the line at ldx, returning its length
+// in bytes. In UTF-8 mode each byte of an invalid sequence comes back as
+// utf8.RuneError on its own.
+func lineChar(line []byte, ldx int, utf8Mode bool) (rune, int) {
+	if !utf8Mode || line[ldx] < utf8.RuneSelf {
+		return rune(line[ldx]), 1
+	}
+	return utf8.DecodeRune(line[ldx:])
 }
 
-type groupZeroOrOneHead struct {
-	groupHead
+type groupHead struct {
+	heads []matchPoint
+	tail  *groupTail
 }
 
-type groupZeroOrMoreHead struct {
+// groupRepeatHead runs its group between min and max times (max < 0 means
+// no limit), as many as possible unless lazy. Its tail loops back to it
+// after each pass through the group.
+type groupRepeatHead struct {
 	groupHead
+	min  int
+	max  int
+	lazy bool
 }
 
 type groupTail struct {
-	startLdx int
-	backrefs *[]string
-	index    int
-	next     matchPoint
+	index int
+	loop  *groupRepeatHead // set when the group is repeated
+	next  matchPoint
 }
 
-func (gh groupHead) matchHere(line []byte, ldx int, isSpecial bool) (bool, int) {
+func (gh groupHead) matchHere(m *matcher, ldx int) (bool, int) {
+	line := m.line
 	debugf("groupHead.matchHere('%s', %d)\n", string(line)[ldx:], ldx)
-	gh.tail.startLdx = ldx
+	return gh.matchBranches(m, ldx)
+}
+
+// matchBranches tries each alternative of the group in turn
+func (gh groupHead) matchBranches(m *matcher, ldx int) (bool, int) {
+	index := gh.tail.index
+	oldStart := m.starts[index]
+	m.starts[index] = ldx
 	for i := 0; i < len(gh.heads); i++ {
-		matched, bytesUsed := gh.heads[i].matchHere(line, ldx, isSpecial)
+		matched, end := gh.heads[i].matchHere(m, ldx)
 		if matched {
-			return true, bytesUsed
+			return true, end
 		}
 	}
+	m.starts[index] = oldStart
 	return false, 0
 }
 
-func (gt groupTail) matchHere(line []byte, ldx int, isSpecial bool) (bool, int) {
-	debugf("got to tail while matching\n")
-	brstr := string(line[gt.startLdx:ldx])
-	debugf("before backrefs=[")
-	for i, s := range *(gt.backrefs) {
-		debugf("%d: '%s', ", i, s)
+func (gr groupRepeatHead) matchHere(m *matcher, ldx int) (bool, int) {
+	debugf("groupRepeatHead{%d,%d}.matchHere('%s', %d)\n", gr.min, gr.max, string(m.line)[ldx:], ldx)
+	// coming in from in front of the group starts the count again, which
+	// matters when this group sits inside another repeated group
+	index := gr.tail.index
+	oldCount := m.counts[index]
+	m.counts[index] = 0
+	matched, end := false, 0
+	if gr.lazy && gr.min == 0 {
+		debugf("lazily trying zero passes\n")
+		matched, end = m.matchNext(gr.tail.next, ldx)
+	}
+	if !matched && gr.max != 0 {
+		matched, end = gr.matchBranches(m, ldx)
+	}
+	if !matched && !gr.lazy && gr.min == 0 {
+		debugf("trying zero passes\n")
+		matched, end = m.matchNext(gr.tail.next, ldx)
 	}
-	debugf("]\n")
-	(*(gt.backrefs))[gt.index] = brstr
-	debugf("brstr='%s'\n", brstr)
-	debugf("after backrefs=[")
-	for i, s := range *(gt.backrefs) {
-		debugf("%d: '%s', ", i, s)
+	if !matched {
+		m.counts[index] = oldCount
 	}
-	debugf("]\n")
-	if isSpecial || gt.next == nil {
-		return true, 0
+	return matched, end
+}
+
+func (gt groupTail) matchHere(m *matcher, ldx int) (bool, int) {
+	debugf("got to tail while matching\n")
+	oldStart, oldEnd := m.caps[2*gt.index], m.caps[2*gt.index+1]
+	m.caps[2*gt.index] = m.starts[gt.index]
+	m.caps[2*gt.index+1] = ldx
+	debugf("caps=%v\n", m.caps)
+
+	var matched bool
+	var end int
+	if gt.loop == nil {
+		matched, end = m.matchNext(gt.next, ldx)
+	} else {
+		matched, end = gt.matchLoop(m, ldx)
+	}
+	if !matched {
+		// put back whatever an earlier pass through the group captured
+		m.caps[2*gt.index], m.caps[2*gt.index+1] = oldStart, oldEnd
 	}
+	return matched, end
+}
 
-	return gt.next.matchHere(line, ldx, isSpecial)
+// matchLoop decides what follows a pass through a repeated group: another
+// pass if we are under the maximum, or what comes after the group if we have
+// reached the minimum. Greedy groups try another pass first, lazy ones last.
+//
+// Once the minimum is reached a pass that matched nothing ends the loop, as
+// it would only match nothing again: (a*)* stops after "aaa" and one empty
+// pass instead of recursing forever.
+func (gt groupTail) matchLoop(m *matcher, ldx int) (bool, int) {
+	m.counts[gt.index]++
+	count := m.counts[gt.index]
+	debugf("completed pass %d\n", count)
+	done := count >= gt.loop.min
+	again := gt.loop.max < 0 || count < gt.loop.max
+	if done && ldx == m.starts[gt.index] {
+		debugf("empty pass through repeated group\n")
+		again = false
+	}
+	if gt.loop.lazy && done {
+		matched, end := m.matchNext(gt.next, ldx)
+		if matched {
+			return true, end
+		}
+	}
+	if again {
+		matched, end := gt.loop.matchBranches(m, ldx)
+		if matched {
+			return true, end
+		}
+	}
+	if !gt.loop.lazy && done {
+		matched, end := m.matchNext(gt.next, ldx)
+		if matched {
+			return true, end
+		}
+	}
+	m.counts[gt.index]--
+	return false, 0
 }
 
 func (gt groupTail) String() string {
@@ -190,210 +406,275 @@ func (gh *groupHead) setNext(n matchPoint) {
 	// does nothing
 }
 
-// returns a linked list representing the regexp pattern
-func parsePattern(pattern string, backrefs *[]string) matchPoint {
-	var rdx int
-	var parseHere func(bool) (matchPoint, matchPoint)
-	backdx := 0
+func (gr groupRepeatHead) String() string {
+	lazy := ""
+	if gr.lazy {
+		lazy = "?"
+	}
+	return fmt.Sprintf("[groupRepeat{%d,%d}%s] %s", gr.min, gr.max, lazy, gr.heads[0])
+}
 
-	groupGlob := func(gh *groupHead) matchPoint {
-		debugf("groupGlob() remaining pattern=%s\n", pattern[rdx:])
-		if rdx+1 >= len(pattern) {
-			debugf("group glob: no glob, at end with '%s'\n", string(pattern[rdx]))
-			return gh
-		}
-		debugf("pattern='%s' rdx=%d\n", pattern, rdx)
-		switch pattern[rdx+1] {
-		case '?':
-			rdx++
-			debugf("group glob: got '?'\n")
-			return &groupZeroOrOneHead{*gh}
-		case '+':
-			rdx++
-			debugf("group glob: got '+'\n")
-			return &groupOneOrMoreHead{*gh}
-		case '*':
-			rdx++
-			debugf("group glob: got '*'\n")
-			return &groupZeroOrMoreHead{*gh}
-		default:
-			debugf("group glob: no glob, got '%s'\n", string(pattern[rdx+1]))
-			return gh
-		}
+///////////////////////////////////////////////////////////
+// Building the matchPoint graph from the parse tree
+
+// builder turns a parse tree into the linked matchPoints that match it.
+// Capturing groups take the first slots in the matcher, by their number,
+// while groups the tree needs for other things come after them.
+type builder struct {
+	utf8  bool
+	names []string // of each capturing group, "" for unnamed ones
+	// groups that do not capture, to be given slots once all the groups are
+	// counted
+	uncaptured []*groupTail
+}
+
+// build returns the first matchPoint of the graph for tree, nil if it
+// matches only the empty string, along with the name of each capturing
+// group and the number of groups of any kind
+func build(tree syntax.Node, utf8Mode bool) (matchPoint, []string, int) {
+	b := &builder{utf8: utf8Mode}
+	head, _ := b.chain(tree)
+	for i, gt := range b.uncaptured {
+		gt.index = len(b.names) + i
 	}
-	parseGroup := func() (matchPoint, matchPoint) {
-		gh := groupHead{}
-		str := ""
-		*backrefs = append(*backrefs, str)
-		debugf("backrefs = %+v\n", *backrefs)
-		gt := groupTail{backrefs: backrefs, index: backdx}
-		backdx++
-		gh.tail = &gt
-
-		for {
-			head, tail := parseHere(true)
-			if head == nil || rdx >= len(pattern) {
-				// reached end of string I guess?
-				fmt.Fprintf(os.Stderr, "error when parsing a group\n")
-				os.Exit(3)
+	return head, b.names, len(b.names) + len(b.uncaptured)
+}
+
+// chain builds the matchPoints for n, returning the first and the last of
+// them, whose next is what follows n. Both are nil if n is empty.
+func (b *builder) chain(n syntax.Node) (head matchPoint, tail matchPoint) {
+	switch n := n.(type) {
+	case *syntax.Literal:
+		// a literal of several characters matches them one at a time
+		for _, c := range n.Runes {
+			mp, _ := b.char(&syntax.Literal{Runes: []rune{c}, Fold: n.Fold})
+			if head == nil {
+				head = mp
+			} else {
+				tail.setNext(mp)
+			}
+			tail = mp
+		}
+		return head, tail
+
+	case *syntax.Class:
+		mp, _ := b.char(n)
+		return mp, mp
+
+	case *syntax.Concat:
+		for _, sub := range n.Subs {
+			h, t := b.chain(sub)
+			if h == nil {
+				continue
 			}
-			debugf("head = got this %s\n", head)
-			gh.heads = append(gh.heads, head)
-			gh.tails = append(gh.tails, tail)
-			tail.setNext(&gt)
-			debugf("gh (%p) = have this %s\n", &gh, gh)
-			switch pattern[rdx] {
-			case ')':
-				return groupGlob(&gh), &gt
-				// incrementing rdx handled by caller
-			case '|':
-				rdx++
-			default:
-				debugf("unexpected character: '%s' - error when parsing a group\n", string(pattern[rdx]))
-				os.Exit(3)
+			if head == nil {
+				head = h
+			} else {
+				tail.setNext(h)
 			}
+			tail = t
+		}
+		return head, tail
+
+	case *syntax.Alternate:
+		gh := b.group(n, -1)
+		return gh, gh.tail
+
+	case *syntax.Group:
+		gh := b.group(n.Sub, n.Index-1)
+		b.name(n)
+		return gh, gh.tail
+
+	case *syntax.Repeat:
+		return b.repeat(n)
+
+	case *syntax.Assertion:
+		switch n.Kind {
+		case syntax.WordBoundary:
+			mp := &wordBoundaryMatchPoint{}
+			return mp, mp
+		case syntax.NotWordBoundary:
+			mp := &wordBoundaryMatchPoint{negated: true}
+			return mp, mp
 		}
+		kind := map[syntax.AssertionKind]anchor{
+			syntax.TextStart:      textStart,
+			syntax.TextEnd:        textEnd,
+			syntax.TextEndNewline: textEndNewline,
+			syntax.LineStart:      lineStart,
+			syntax.LineEnd:        lineEnd,
+		}[n.Kind]
+		mp := &anchorMatchPoint{kind: kind}
+		return mp, mp
+
+	case *syntax.Lookaround:
+		gh := b.group(n.Sub, -1)
+		la := &lookaroundMatchPoint{body: gh, tail: gh.tail, behind: n.Behind, negated: n.Negated}
+		if n.Behind {
+			la.min, la.max = syntax.Width(n.Sub)
+			la.tail.setNext(&lookbehindEnd{tail: la.tail})
+		}
+		return la, la
+
+	case *syntax.Backref:
+		mp := &backrefPoint{index: n.Index - 1, caseless: n.Fold}
+		return mp, mp
 	}
+	panic(fmt.Sprintf("regexp: unexpected %T in parse tree", n))
+}
 
-	// handles ? + * characters when they glob
-	// will not be used if at start of line or after \
-	glob := func(mp *basicMatchPoint) matchPoint {
-		if rdx+1 >= len(pattern) {
-			debugf("regex glob: no glob, at end with '%s'\n", string(pattern[rdx]))
-			return mp
+// char returns the matchPoint for n if it matches a single character
+func (b *builder) char(n syntax.Node) (*basicMatchPoint, bool) {
+	switch n := n.(type) {
+	case *syntax.Literal:
+		if len(n.Runes) != 1 {
+			return nil, false
 		}
-		debugf("pattern='%s' rdx=%d\n", pattern, rdx)
-		switch pattern[rdx+1] {
-		case '?':
-			rdx++
-			debugf("regex glob: got '?'\n")
-			return &zeroOrOneMatchPoint{*mp}
-		case '+':
-			rdx++
-			debugf("regex glob: got '+'\n")
-			return &oneOrMoreMatchPoint{*mp}
-		case '*':
-			rdx++
-			debugf("regex glob: got '*'\n")
-			return &zeroOrMoreMatchPoint{*mp}
-		default:
-			debugf("regex glob: no glob, got '%s'\n", string(pattern[rdx+1]))
-			return mp
+		c := n.Runes[0]
+		if n.Fold {
+			return &basicMatchPoint{ranges: syntax.Fold([]syntax.Range{{Lo: c, Hi: c}}, b.utf8)}, true
 		}
+		return &basicMatchPoint{matchChars: string(c)}, true
+	case *syntax.Class:
+		return &basicMatchPoint{ranges: n.Ranges, inverted: n.Negated}, true
 	}
+	return nil, false
+}
 
-	parseHere = func(isGroup bool) (matchPoint, matchPoint) {
-		regex := []matchPoint{}
-		var p matchPoint
-	loop:
-		for rdx < len(pattern) {
-			var err error
-			switch pattern[rdx] {
-			case '[':
-				rdx++
-				var b *basicMatchPoint
-				b, err = parseSetPattern(&pattern, &rdx)
-				if err != nil {
-					os.Exit(3)
-				}
-				p = glob(b)
-
-			case '(':
-				rdx++ // move past (
-				p, q := parseGroup()
-				regex = append(regex, p)
-				regex = append(regex, q)
-				debugf("pos = %s\n", pattern[rdx:])
-				rdx++ // move past )
-				continue
-
-			case '|':
-				fallthrough
-			case ')':
-				if isGroup {
-					break loop
-				} else {
-					p = glob(&basicMatchPoint{matchChars: string(pattern[rdx])})
-				}
-
-			case '$':
-				if rdx == len(pattern)-1 {
-					p = &matchEndMatchPoint{}
-				} else {
-					p = glob(&basicMatchPoint{matchChars: string(pattern[rdx])})
-				}
-
-			case '.':
-				debugf("regex parse: got '.'\n")
-				p = glob(&basicMatchPoint{"", true, nil})
-
-			case '\\':
-				rdx++
-				if rdx < len(pattern) {
-					switch pattern[rdx] {
-					case 'w':
-						p = glob(&basicMatchPoint{matchChars: wordChars})
-					case 'd':
-						p = glob(&basicMatchPoint{matchChars: digits})
-					case '1':
-						p = &backrefPoint{backrefs, 0, nil}
-					case '2':
-						p = &backrefPoint{backrefs, 1, nil}
-					case '3':
-						p = &backrefPoint{backrefs, 2, nil}
-					case '4':
-						p = &backrefPoint{backrefs, 3, nil}
-					case '5':
-						p = &backrefPoint{backrefs, 4, nil}
-					case '6':
-						p = &backrefPoint{backrefs, 5, nil}
-					case '7':
-						p = &backrefPoint{backrefs, 6, nil}
-					case '8':
-						p = &backrefPoint{backrefs, 7, nil}
-					case '9':
-						p = &backrefPoint{backrefs, 8, nil}
-					default:
-						p = glob(&basicMatchPoint{matchChars: string(pattern[rdx])})
-					}
-				} else {
-					// last character was a backslash....
-					// I guess append a backslash character?
-					p = glob(&basicMatchPoint{matchChars: "\\"})
-				}
-
-			default:
-				p = glob(&basicMatchPoint{matchChars: string(pattern[rdx])})
-			}
-			regex = append(regex, p)
-			rdx++
-		}
-		if len(regex) == 0 {
-			// XXX should probably just bail if this is the case?
-			return nil, nil
+// group builds a group holding n, whose alternatives if it has them are
+// each a way through the group. index is its capturing group's number less
+// one, or -1 if it does not capture.
+func (b *builder) group(n syntax.Node, index int) *groupHead {
+	gt := &groupTail{index: index}
+	if index < 0 {
+		b.uncaptured = append(b.uncaptured, gt)
+	}
+	gh := &groupHead{tail: gt}
+	alternatives := []syntax.Node{n}
+	if alt, ok := n.(*syntax.Alternate); ok {
+		alternatives = alt.Subs
+	}
+	for _, alt := range alternatives {
+		head, tail := b.chain(alt)
+		if head == nil {
+			head = gt
+		} else {
+			tail.setNext(gt)
 		}
-		for i := 0; i < len(regex)-1; i++ {
-			regex[i].setNext(regex[i+1])
+		gh.heads = append(gh.heads, head)
+	}
+	return gh
+}
+
+// name records the name of a capturing group
+func (b *builder) name(g *syntax.Group) {
+	for len(b.names) < g.Index {
+		b.names = append(b.names, "")
+	}
+	b.names[g.Index-1] = g.Name
+}
+
+// repeat builds a repeat, which for a single character is a single
+// matchPoint and for anything else a group that loops back on itself
+func (b *builder) repeat(r *syntax.Repeat) (matchPoint, matchPoint) {
+	if mp, ok := b.char(r.Sub); ok {
+		var p matchPoint
+		// lazy quantifiers are all handled by countedMatchPoint
+		switch {
+		case r.Lazy:
+			p = &countedMatchPoint{*mp, r.Min, r.Max, true}
+		case r.Min == 0 && r.Max == 1:
+			p = &zeroOrOneMatchPoint{*mp}
+		case r.Min == 1 && r.Max < 0:
+			p = &oneOrMoreMatchPoint{*mp}
+		case r.Min == 0 && r.Max < 0:
+			p = &zeroOrMoreMatchPoint{*mp}
+		default:
+			p = &countedMatchPoint{*mp, r.Min, r.Max, false}
 		}
-		return regex[0], regex[len(regex)-1]
+		return p, p
+	}
+	var gh *groupHead
+	if g, ok := r.Sub.(*syntax.Group); ok {
+		gh = b.group(g.Sub, g.Index-1)
+		b.name(g)
+	} else {
+		gh = b.group(r.Sub, -1)
 	}
-	retval, _ := parseHere(false)
-	return retval
+	// the tail has to know where to loop back to
+	gr := &groupRepeatHead{*gh, r.Min, r.Max, r.Lazy}
+	gh.tail.loop = gr
+	return gr, gh.tail
+}
+
+///////////////////////////////////////////////////////////
+// matcher holds the state of a single match attempt
+
+// matcher holds everything that changes while a line is being matched, so
+// the matchPoint graph itself is never written to after parsing
+type matcher struct {
+	line   []byte
+	utf8   bool  // decode the line as UTF-8
+	caps   []int // start and end offsets of each group, -1 while unset
+	starts []int // offset each group was last entered at
+	counts []int // passes made so far through each repeated group
+	// where the body of each lookbehind must end, by the slot of its group
+	targets []int
+}
+
+func (re *RegExp) newMatcher(line []byte) *matcher {
+	m := &matcher{
+		line:    line,
+		utf8:    re.utf8,
+		caps:    make([]int, 2*re.numSlots),
+		starts:  make([]int, re.numSlots),
+		counts:  make([]int, re.numSlots),
+		targets: make([]int, re.numSlots),
+	}
+	m.reset()
+	return m
+}
+
+// reset clears the captures before trying the next starting offset
+func (m *matcher) reset() {
+	for i := range m.caps {
+		m.caps[i] = -1
+	}
+	for i := range m.starts {
+		m.starts[i] = -1
+	}
+}
+
+// char decodes the character at ldx, returning it and its length in bytes
+func (m *matcher) char(ldx int) (rune, int) {
+	return lineChar(m.line, ldx, m.utf8)
 }
 
 ///////////////////////////////////////////////////////////
 // matchPoints performs matching at a single point
 
+// matchHere tries to match this point and everything after it with the
+// line at ldx. On success it returns the offset the whole match ends at.
 type matchPoint interface {
 	fmt.Stringer
-	matchHere(line []byte, ldx int, isSpecial bool) (bool, int)
+	matchHere(m *matcher, ldx int) (bool, int)
 	setNext(matchPoint)
 }
 
+// matchNext continues the match with n, or finishes it if n is the end of
+// the chain
+func (m *matcher) matchNext(n matchPoint, ldx int) (bool, int) {
+	if n == nil {
+		debugf("finished matching at %d\n", ldx)
+		return true, ldx
+	}
+	return n.matchHere(m, ldx)
+}
+
 type backrefPoint struct {
-	backrefString *[]string
-	index         int
-	next          matchPoint
+	index    int
+	caseless bool
+	next     matchPoint
 }
 
 func (b backrefPoint) String() string {
@@ -404,42 +685,54 @@ func (b *backrefPoint) setNext(n matchPoint) {
 	b.next = n
 }
 
-func (b backrefPoint) matchHere(line []byte, ldx int, isSpecial bool) (bool, int) {
-	debugf("backrefPoint'%d'.matchHere(%s, %d, %v)\n", b.index+1, string(line[ldx:]), ldx, isSpecial)
-	backref := []byte((*(b.backrefString))[b.index])
-	debugf("backrefs = [")
-	for i, s := range *(b.backrefString) {
-		debugf("%d: %s", i, s)
-		if i == len(*(b.backrefString))-1 {
-			debugf(", ")
-		}
+func (b backrefPoint) matchHere(m *matcher, ldx int) (bool, int) {
+	line := m.line
+	debugf("backrefPoint'%d'.matchHere(%s, %d)\n", b.index+1, string(line[ldx:]), ldx)
+	start, end := m.caps[2*b.index], m.caps[2*b.index+1]
+	debugf("caps=%v\n", m.caps)
+	if start < 0 {
+		debugf("group %d has not matched\n", b.index+1)
+		return false, 0
 	}
-	debugf("]\n")
+	backref := line[start:end]
 
 	debugf("backref=%s\n", string(backref))
-	if ldx+len(backref) > len(line) {
-		debugf("oops, got to long\n")
+	if b.caseless {
+		return b.matchFolded(m, start, end, ldx)
+	}
+	if !bytes.HasPrefix(line[ldx:], backref) {
+		debugf("no match\n")
 		return false, 0
 	}
-	for _, c := range backref {
-		if line[ldx] != c {
+	return m.matchNext(b.next, ldx+len(backref))
+}
+
+// matchFolded matches the text captured between start and end ignoring
+// case, a character at a time since folding can change the length of it
+func (b backrefPoint) matchFolded(m *matcher, start, end, ldx int) (bool, int) {
+	for start < end {
+		if ldx >= len(m.line) {
 			return false, 0
 		}
-		ldx++
-	}
-	debugf("line_remaining=%s\n", string(line[ldx:]))
-
-	if b.next == nil {
-		debugf("finished matching\n")
-		return true, len(backref)
+		want, wantSize := m.char(start)
+		got, gotSize := m.char(ldx)
+		if !syntax.EqualFold(want, got, m.utf8) {
+			debugf("no match\n")
+			return false, 0
+		}
+		start += wantSize
+		ldx += gotSize
 	}
-	return b.next.matchHere(line, ldx, isSpecial)
+	return m.matchNext(b.next, ldx)
 }
 
+// basicMatchPoint matches a single character that is in matchChars or one
+// of the ranges, or that is in neither if inverted
 type basicMatchPoint struct {
 	matchChars string
 	inverted   bool
 	next       matchPoint
+	ranges     []syntax.Range
 }
 
 type oneOrMoreMatchPoint struct {
@@ -454,7 +747,60 @@ type zeroOrOneMatchPoint struct {
 	basicMatchPoint
 }
 
-type matchEndMatchPoint struct{}
+// countedMatchPoint matches between min and max times (max < 0 means no
+// limit), as many as possible unless lazy
+type countedMatchPoint struct {
+	basicMatchPoint
+	min  int
+	max  int
+	lazy bool
+}
+
+// anchorMatchPoint matches without using up any of the line, at one of
+// the places an anchor stands for
+type anchorMatchPoint struct {
+	kind anchor
+	next matchPoint
+}
+
+// anchor says where an anchorMatchPoint matches
+type anchor int
+
+const (
+	textStart      anchor = iota // \A, and ^ outside multi-line mode
+	textEnd                      // \z, and $ outside multi-line mode
+	textEndNewline               // \Z, which also allows one final newline
+	lineStart                    // ^ in multi-line mode
+	lineEnd                      // $ in multi-line mode
+)
+
+// wordBoundaryMatchPoint is \b, matching without using up any of the line
+// where a word character meets a non-word character or either end of the
+// line. Negated it is \B, matching everywhere else.
+type wordBoundaryMatchPoint struct {
+	negated bool
+	next    matchPoint
+}
+
+// lookaroundMatchPoint matches without using up any of the line when its
+// body matches at this point, or when it does not if negated. A lookahead
+// body starts here, a lookbehind body has to end here, and being of bounded
+// length it can only start a few characters back.
+type lookaroundMatchPoint struct {
+	body     matchPoint
+	tail     *groupTail // the end of the body
+	behind   bool
+	negated  bool
+	min, max int // characters a lookbehind body can match
+	next     matchPoint
+}
+
+// lookbehindEnd follows the body of a lookbehind, only letting it match when
+// it reaches the point the lookbehind is at
+type lookbehindEnd struct {
+	tail *groupTail
+	next matchPoint
+}
 
 // checking interfaces are implemented fully
 var (
@@ -462,7 +808,12 @@ var (
 	_ matchPoint = &oneOrMoreMatchPoint{}
 	_ matchPoint = &zeroOrMoreMatchPoint{}
 	_ matchPoint = &zeroOrOneMatchPoint{}
-	_ matchPoint = matchEndMatchPoint{}
+	_ matchPoint = &countedMatchPoint{}
+	_ matchPoint = &groupRepeatHead{}
+	_ matchPoint = &anchorMatchPoint{}
+	_ matchPoint = &lookaroundMatchPoint{}
+	_ matchPoint = &lookbehindEnd{}
+	_ matchPoint = &wordBoundaryMatchPoint{}
 	_ matchPoint = &groupHead{}
 	_ matchPoint = &groupTail{}
 	_ matchPoint = &backrefPoint{}
@@ -479,7 +830,11 @@ func (mp basicMatchPoint) recursiveString(mytype string) string {
 	if mp.inverted {
 		invChar = "^"
 	}
-	return fmt.Sprintf("%s: [%s%s]%s", mytype, invChar, mp.matchChars, remainder)
+	ranges := ""
+	for _, r := range mp.ranges {
+		ranges += fmt.Sprintf("%c-%c", r.Lo, r.Hi)
+	}
+	return fmt.Sprintf("%s: [%s%s%s]%s", mytype, invChar, mp.matchChars, ranges, remainder)
 }
 
 func (mp basicMatchPoint) String() string {
@@ -498,140 +853,299 @@ func (mp zeroOrOneMatchPoint) String() string {
 	return mp.recursiveString("zeroOrOne")
 }
 
-func (e matchEndMatchPoint) String() string {
-	return "[end '$']"
+func (mp countedMatchPoint) String() string {
+	lazy := ""
+	if mp.lazy {
+		lazy = "?"
+	}
+	return mp.recursiveString(fmt.Sprintf("counted{%d,%d}%s", mp.min, mp.max, lazy))
+}
+
+func (a anchorMatchPoint) String() string {
+	remainder := ""
+	if a.next != nil {
+		remainder = ", " + a.next.String()
+	}
+	return fmt.Sprintf("[%s]%s", [...]string{"\\A", "\\z", "\\Z", "^", "$"}[a.kind], remainder)
 }
 
-func (mp basicMatchPoint) matchByte(c byte) bool {
-	matches := strings.Contains(mp.matchChars, string(c))
+func (wb wordBoundaryMatchPoint) String() string {
+	remainder := ""
+	if wb.next != nil {
+		remainder = ", " + wb.next.String()
+	}
+	if wb.negated {
+		return "[not boundary]" + remainder
+	}
+	return "[boundary]" + remainder
+}
+
+func (mp basicMatchPoint) matchChar(c rune) bool {
+	matches := strings.ContainsRune(mp.matchChars, c) || syntax.InRanges(mp.ranges, c)
 	if mp.inverted {
 		matches = !matches
 	}
 	return matches
 }
 
-func (mp basicMatchPoint) matchHere(line []byte, ldx int, isSpecial bool) (bool, int) {
+// runEnds finds how far a run of up to limit matching characters from ldx
+// reaches (limit < 0 means no limit), returning the offset after each
+// length of run from zero up
+func (mp basicMatchPoint) runEnds(m *matcher, ldx int, limit int) []int {
+	ends := []int{ldx}
+	for ldx < len(m.line) && (limit < 0 || len(ends) <= limit) {
+		c, size := m.char(ldx)
+		if !mp.matchChar(c) {
+			break
+		}
+		ldx += size
+		ends = append(ends, ldx)
+	}
+	return ends
+}
+
+func (mp basicMatchPoint) matchHere(m *matcher, ldx int) (bool, int) {
+	line := m.line
 	debugf("mp=%#v\n", mp)
 	debugf("basicMatchPoint.matchHere('%s', %d)\n", string(line)[ldx:], ldx)
 	if ldx >= len(line) {
 		debugf("oops, got to long\n")
 		return false, 0
 	}
-	if !mp.matchByte(line[ldx]) {
+	c, size := m.char(ldx)
+	if !mp.matchChar(c) {
 		debugf("no match\n")
 		return false, 0
 	}
-	if mp.next == nil {
-		debugf("finished matching\n")
-		return true, 1
-	}
-	return mp.next.matchHere(line, ldx+1, isSpecial)
+	return m.matchNext(mp.next, ldx+size)
 }
 
-func (mp zeroOrOneMatchPoint) matchHere(line []byte, ldx int, isSpecial bool) (bool, int) {
+func (mp zeroOrOneMatchPoint) matchHere(m *matcher, ldx int) (bool, int) {
+	line := m.line
 	debugf("mp=%#v\n", mp)
 	debugf("zeroOrOneMatchPoint.matchHere('%s', %d)\n", string(line)[ldx:], ldx)
-	// XXX ah, but we don't want to short circuit if inGroup
-	if !isSpecial && mp.next == nil {
-		debugf("short circuit match\n")
-		return true, 0
-	}
-	if ldx >= len(line) {
-		debugf("at end, so trying zero length\n")
-		return mp.next.matchHere(line, ldx, isSpecial)
-	}
-	if !mp.matchByte(line[ldx]) {
-		debugf("no match, so trying zero length\n")
-		return mp.next.matchHere(line, ldx, isSpecial)
+	if ldx < len(line) {
+		if c, size := m.char(ldx); mp.matchChar(c) {
+			matched, end := m.matchNext(mp.next, ldx+size)
+			if matched {
+				return true, end
+			}
+		}
 	}
-	return mp.next.matchHere(line, ldx+1, isSpecial)
+	debugf("trying zero length\n")
+	return m.matchNext(mp.next, ldx)
 }
 
-func (mp zeroOrMoreMatchPoint) matchHere(line []byte, ldx int, isSpecial bool) (bool, int) {
+func (mp zeroOrMoreMatchPoint) matchHere(m *matcher, ldx int) (bool, int) {
+	line := m.line
 	debugf("mp=%#v\n", mp)
 	debugf("zeroOrMoreMatchPoint.matchHere('%s', %d)\n", string(line)[ldx:], ldx)
-	if !isSpecial && mp.next == nil {
-		debugf("short circuit match\n")
-		return true, 0
-	}
-	if ldx >= len(line) {
-		debugf("at end, so trying zero length\n")
-		return mp.next.matchHere(line, ldx, isSpecial)
-	}
 	// finding max length that will match and then working backwards
-	maxLength := 0
-	for ; maxLength+ldx < len(line); maxLength++ {
-		if !mp.matchByte(line[maxLength+ldx]) {
-			// keep incrementing until we fail to match or hit the end
-			break
+	ends := mp.runEnds(m, ldx, -1)
+	debugf("maxLength: %d\n", len(ends)-1)
+	for trialLength := len(ends) - 1; trialLength >= 0; trialLength-- {
+		debugf("trialLength: %d\n", trialLength)
+		matched, end := m.matchNext(mp.next, ends[trialLength])
+		if matched {
+			return true, end
 		}
 	}
-	debugf("maxLength: %d\n", maxLength)
-	// here is the working backwards
-	for trialLength := maxLength; trialLength >= 0; trialLength-- {
+	return false, 0
+}
+
+func (mp oneOrMoreMatchPoint) matchHere(m *matcher, ldx int) (bool, int) {
+	line := m.line
+	debugf("mp=%#v\n", mp)
+	debugf("oneOrMoreMatchPoint.matchHere('%s', %d)\n", string(line)[ldx:], ldx)
+	// finding max length that will match and then working backwards, but
+	// never giving back the first one
+	ends := mp.runEnds(m, ldx, -1)
+	debugf("maxLength: %d\n", len(ends)-1)
+	for trialLength := len(ends) - 1; trialLength >= 1; trialLength-- {
 		debugf("trialLength: %d\n", trialLength)
-		matched, bytesUsed := mp.next.matchHere(line, ldx+trialLength, isSpecial)
+		matched, end := m.matchNext(mp.next, ends[trialLength])
 		if matched {
-			return true, bytesUsed
+			return true, end
 		}
 	}
 	return false, 0
 }
 
-func (mp oneOrMoreMatchPoint) matchHere(line []byte, ldx int, isSpecial bool) (bool, int) {
+func (mp countedMatchPoint) matchHere(m *matcher, ldx int) (bool, int) {
+	line := m.line
 	debugf("mp=%#v\n", mp)
-	debugf("zeroOrMoreMatchPoint.matchHere('%s', %d)\n", string(line)[ldx:], ldx)
-	if ldx >= len(line) {
-		debugf("at end, so trying zero length\n")
-		return mp.next.matchHere(line, ldx, isSpecial)
-	}
-	// need at least one
-	if !mp.matchByte(line[ldx]) {
-		debugf("no match\n")
-		return false, 0
-	}
-	if !isSpecial && mp.next == nil {
-		debugf("short circuit match\n")
-		// really we would want to do the full match is we wanted to show the matching part... but we do not so bug out here...
-		return true, 1
-	}
-	// finding max length that will match and then working backwards
-	maxLength := 1
-	for ; maxLength+ldx < len(line); maxLength++ {
-		if !mp.matchByte(line[maxLength+ldx]) {
-			// keep incrementing until we fail to match or hit the end
-			break
+	debugf("countedMatchPoint.matchHere('%s', %d)\n", string(line)[ldx:], ldx)
+	ends := mp.runEnds(m, ldx, mp.max)
+	maxLength := len(ends) - 1
+	debugf("maxLength: %d\n", maxLength)
+	if mp.lazy {
+		// working forwards from the shortest run instead
+		for trialLength := mp.min; trialLength <= maxLength; trialLength++ {
+			debugf("trialLength: %d\n", trialLength)
+			matched, end := m.matchNext(mp.next, ends[trialLength])
+			if matched {
+				return true, end
+			}
 		}
+		return false, 0
 	}
-	debugf("maxLength: %d\n", maxLength)
-	// here is the working backwards
-	for trialLength := maxLength; trialLength >= 0; trialLength-- {
+	for trialLength := maxLength; trialLength >= mp.min; trialLength-- {
 		debugf("trialLength: %d\n", trialLength)
-		matched, bytesUsed := mp.next.matchHere(line, ldx+trialLength, isSpecial)
+		matched, end := m.matchNext(mp.next, ends[trialLength])
 		if matched {
-			return true, bytesUsed
+			return true, end
 		}
 	}
 	return false, 0
 }
 
-func (e matchEndMatchPoint) matchHere(line []byte, ldx int, _ bool) (bool, int) {
-	debugf("mp=%#v\n", e)
-	debugf("matchEndMatchPoint.matchHere('%s', %d)\n", string(line)[ldx:], ldx)
-	atEnd := ldx == len(line)
-	if atEnd {
-		debugf("Matched at end and regexp has $\n")
-		return true, 0
+// holds reports whether the anchor matches at ldx in line
+func (a anchorMatchPoint) holds(line []byte, ldx int, utf8Mode bool) bool {
+	switch a.kind {
+	case textStart:
+		return ldx == 0
+	case textEnd:
+		return ldx == len(line)
+	case textEndNewline:
+		return ldx == len(line) || ldx == len(line)-1 && line[ldx] == '\n'
+	case lineStart:
+		return ldx == 0 || line[ldx-1] == '\n'
+	case lineEnd:
+		return ldx == len(line) || line[ldx] == '\n'
 	}
-	debugf("Not at end and regexp has $\n")
-	return false, 0
+	return false
+}
+
+func (a anchorMatchPoint) matchHere(m *matcher, ldx int) (bool, int) {
+	line := m.line
+	debugf("anchorMatchPoint.matchHere('%s', %d)\n", string(line)[ldx:], ldx)
+	if !a.holds(line, ldx, m.utf8) {
+		debugf("no match\n")
+		return false, 0
+	}
+	return m.matchNext(a.next, ldx)
+}
+
+// holds reports whether ldx is (or for \B is not) a word boundary in line
+func (wb wordBoundaryMatchPoint) holds(line []byte, ldx int, utf8Mode bool) bool {
+	before, after := false, false
+	if ldx > 0 {
+		c := rune(line[ldx-1])
+		if utf8Mode {
+			c, _ = utf8.DecodeLastRune(line[:ldx])
+		}
+		before = syntax.IsWordChar(c, utf8Mode)
+	}
+	if ldx < len(line) {
+		c, _ := lineChar(line, ldx, utf8Mode)
+		after = syntax.IsWordChar(c, utf8Mode)
+	}
+	return (before != after) != wb.negated
+}
+
+func (wb wordBoundaryMatchPoint) matchHere(m *matcher, ldx int) (bool, int) {
+	line := m.line
+	debugf("wordBoundaryMatchPoint.matchHere('%s', %d)\n", string(line)[ldx:], ldx)
+	if !wb.holds(line, ldx, m.utf8) {
+		debugf("no match\n")
+		return false, 0
+	}
+	return m.matchNext(wb.next, ldx)
+}
+
+func (wb *wordBoundaryMatchPoint) setNext(n matchPoint) {
+	wb.next = n
 }
 
 func (mp *basicMatchPoint) setNext(n matchPoint) {
 	mp.next = n
 }
 
-func (e matchEndMatchPoint) setNext(_ matchPoint) {
-	// should exit as this would be a clear error?
-	os.Exit(3)
+func (a *anchorMatchPoint) setNext(n matchPoint) {
+	a.next = n
+}
+
+func (la lookaroundMatchPoint) String() string {
+	remainder := ""
+	if la.next != nil {
+		remainder = ", " + la.next.String()
+	}
+	kind := "="
+	if la.negated {
+		kind = "!"
+	}
+	if la.behind {
+		kind = "<" + kind
+	}
+	return fmt.Sprintf("[lookaround ?%s %s]%s", kind, la.body, remainder)
+}
+
+func (la lookaroundMatchPoint) matchHere(m *matcher, ldx int) (bool, int) {
+	debugf("lookaroundMatchPoint.matchHere('%s', %d)\n", string(m.line)[ldx:], ldx)
+	// groups in the body keep what they captured only if the body matched
+	// and the rest of the pattern does too
+	saved := slices.Clone(m.caps)
+	var found bool
+	if la.behind {
+		found = la.matchBehind(m, ldx)
+	} else {
+		found, _ = m.matchNext(la.body, ldx)
+	}
+	if found == la.negated {
+		debugf("no match\n")
+		copy(m.caps, saved)
+		return false, 0
+	}
+	if la.negated {
+		copy(m.caps, saved)
+	}
+	matched, end := m.matchNext(la.next, ldx)
+	if !matched {
+		copy(m.caps, saved)
+	}
+	return matched, end
+}
+
+// matchBehind tries the body from each point it could start at to end at
+// ldx, furthest back first
+func (la lookaroundMatchPoint) matchBehind(m *matcher, ldx int) bool {
+	starts := []int{ldx}
+	for start := ldx; start > 0 && len(starts) <= la.max; {
+		size := 1
+		if m.utf8 {
+			_, size = utf8.DecodeLastRune(m.line[:start])
+		}
+		start -= size
+		starts = append(starts, start)
+	}
+	index := la.tail.index
+	oldTarget := m.targets[index]
+	m.targets[index] = ldx
+	defer func() { m.targets[index] = oldTarget }()
+	for length := len(starts) - 1; length >= la.min; length-- {
+		if found, _ := m.matchNext(la.body, starts[length]); found {
+			return true
+		}
+	}
+	return false
+}
+
+func (la *lookaroundMatchPoint) setNext(n matchPoint) {
+	la.next = n
+}
+
+func (le lookbehindEnd) String() string {
+	return "[lookbehind end]"
+}
+
+func (le lookbehindEnd) matchHere(m *matcher, ldx int) (bool, int) {
+	if ldx != m.targets[le.tail.index] {
+		debugf("lookbehind body does not reach %d\n", m.targets[le.tail.index])
+		return false, 0
+	}
+	return m.matchNext(le.next, ldx)
+}
+
+func (le *lookbehindEnd) setNext(n matchPoint) {
+	le.next = n
 }
@@ -1,10 +1,18 @@
 package regexp
 
-import "testing"
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/codecrafters-io/grep-starter-go/cmd/mygrep/regexp/syntax"
+)
 
 func RegexTester(lineStr string, pattern string) bool {
 	line := []byte(lineStr)
-	regex := ParseRegExp(pattern)
+	regex := MustCompile(pattern)
 	return regex.MatchLine(line)
 }
 
@@ -281,12 +289,6 @@ var tests = []RegexInput{
 		pattern:  "c(ol|aa)t",
 		expected: false,
 	},
-	// {
-	// 	name:     "backref_err",
-	// 	line:     "the cat is a cat",
-	// 	pattern:  "the cat is a \\1",
-	// 	expected: error, // there is no group
-	// },
 	{
 		name:     "backref_t",
 		line:     "the cat is a cat",
@@ -299,14 +301,2110 @@ var tests = []RegexInput{
 		pattern:  "the (cat) is a \\1",
 		expected: false,
 	},
-}
-
-func TestRegexTableDriven(t *testing.T) {
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := RegexTester(tt.line, tt.pattern); got != tt.expected {
-				t.Errorf("%s ~ /%s/ = %v; want %v", tt.line, tt.pattern, got, tt.expected)
-			}
-		})
-	}
+	{
+		name:     "counted_exact_t",
+		line:     "caaat",
+		pattern:  "ca{3}t",
+		expected: true,
+	},
+	{
+		name:     "counted_exact_f",
+		line:     "caat",
+		pattern:  "ca{3}t",
+		expected: false,
+	},
+	{
+		name:     "counted_at_least_t",
+		line:     "caaaaat",
+		pattern:  "ca{2,}t",
+		expected: true,
+	},
+	{
+		name:     "counted_at_least_f",
+		line:     "cat",
+		pattern:  "ca{2,}t",
+		expected: false,
+	},
+	{
+		name:     "counted_range_t",
+		line:     "caat",
+		pattern:  "ca{1,2}t",
+		expected: true,
+	},
+	{
+		name:     "counted_range_f",
+		line:     "caaat",
+		pattern:  "ca{1,2}t",
+		expected: false,
+	},
+	{
+		name:     "counted_zero_t",
+		line:     "xy",
+		pattern:  "xa{0}y",
+		expected: true,
+	},
+	{
+		name:     "counted_set_t",
+		line:     "id 4821",
+		pattern:  "[0123456789]{4}",
+		expected: true,
+	},
+	{
+		name:     "counted_digits_f",
+		line:     "id 482",
+		pattern:  "\\d{4}",
+		expected: false,
+	},
+	{
+		name:     "counted_group_t",
+		line:     "xababx",
+		pattern:  "x(ab){2}x",
+		expected: true,
+	},
+	{
+		name:     "counted_group_f",
+		line:     "xabx",
+		pattern:  "x(ab){2}x",
+		expected: false,
+	},
+	{
+		name:     "counted_group_alternation_t",
+		line:     "abac",
+		pattern:  "^(a|b){3}c",
+		expected: true,
+	},
+	{
+		name:     "counted_group_range_f",
+		line:     "xababababx",
+		pattern:  "x(ab){1,3}x",
+		expected: false,
+	},
+	{
+		name:     "counted_group_zero_t",
+		line:     "xx",
+		pattern:  "x(ab){0,2}x",
+		expected: true,
+	},
+	{
+		name:     "counted_nested_t",
+		line:     "aabaab",
+		pattern:  "^((a){2}b){2}$",
+		expected: true,
+	},
+	{
+		name:     "counted_nested_f",
+		line:     "aabab",
+		pattern:  "^((a){2}b){2}$",
+		expected: false,
+	},
+	{
+		name:     "counted_group_backref_t",
+		line:     "ab-ab",
+		pattern:  "(\\w){2}-a\\1",
+		expected: true,
+	},
+	{
+		name:     "range_t",
+		line:     "x7",
+		pattern:  "[0-9]",
+		expected: true,
+	},
+	{
+		name:     "range_f",
+		line:     "abc",
+		pattern:  "[0-9]",
+		expected: false,
+	},
+	{
+		name:     "ranges_t",
+		line:     "_Q_",
+		pattern:  "[a-zA-Z]",
+		expected: true,
+	},
+	{
+		name:     "ranges_f",
+		line:     "_-_",
+		pattern:  "[a-zA-Z]",
+		expected: false,
+	},
+	{
+		name:     "range_and_chars_t",
+		line:     "id-9",
+		pattern:  "^[a-z]+-[0-9xyz]$",
+		expected: true,
+	},
+	{
+		name:     "range_and_chars_f",
+		line:     "id-q",
+		pattern:  "^[a-z]+-[0-9xyz]$",
+		expected: false,
+	},
+	{
+		name:     "negated_range_t",
+		line:     "abc!",
+		pattern:  "[^a-z]",
+		expected: true,
+	},
+	{
+		name:     "negated_range_f",
+		line:     "abc",
+		pattern:  "[^a-z]",
+		expected: false,
+	},
+	{
+		name:     "set_digit_escape_t",
+		line:     "a_b",
+		pattern:  "a[\\d_]b",
+		expected: true,
+	},
+	{
+		name:     "set_digit_escape_t",
+		line:     "a5b",
+		pattern:  "a[\\d_]b",
+		expected: true,
+	},
+	{
+		name:     "set_digit_escape_f",
+		line:     "adb",
+		pattern:  "a[\\d_]b",
+		expected: false,
+	},
+	{
+		name:     "set_word_escape_t",
+		line:     "x-y",
+		pattern:  "x[\\w-]y",
+		expected: true,
+	},
+	{
+		name:     "set_space_escape_t",
+		line:     "a\tb",
+		pattern:  "a[\\s]b",
+		expected: true,
+	},
+	{
+		name:     "set_space_escape_f",
+		line:     "asb",
+		pattern:  "a[\\s]b",
+		expected: false,
+	},
+	{
+		name:     "negated_shorthand_f",
+		line:     "12 34",
+		pattern:  "^[^\\d\\s]",
+		expected: false,
+	},
+	{
+		name:     "negated_shorthand_t",
+		line:     "x12",
+		pattern:  "^[^\\d\\s]",
+		expected: true,
+	},
+	{
+		name:     "leading_bracket_t",
+		line:     "]",
+		pattern:  "[]a]",
+		expected: true,
+	},
+	{
+		name:     "leading_bracket_t",
+		line:     "a",
+		pattern:  "[]a]",
+		expected: true,
+	},
+	{
+		name:     "leading_bracket_f",
+		line:     "b",
+		pattern:  "[]a]",
+		expected: false,
+	},
+	{
+		name:     "negated_leading_bracket_f",
+		line:     "]]",
+		pattern:  "[^]a]",
+		expected: false,
+	},
+	{
+		name:     "negated_leading_bracket_t",
+		line:     "]b",
+		pattern:  "[^]a]",
+		expected: true,
+	},
+	{
+		name:     "escaped_bracket_t",
+		line:     "]",
+		pattern:  "[a\\]]",
+		expected: true,
+	},
+	{
+		name:     "escaped_bracket_f",
+		line:     "b]",
+		pattern:  "^[a\\]]$",
+		expected: false,
+	},
+	{
+		name:     "escaped_backslash_t",
+		line:     "a\\b",
+		pattern:  "a[\\\\]b",
+		expected: true,
+	},
+	{
+		name:     "leading_dash_t",
+		line:     "-",
+		pattern:  "[-a]",
+		expected: true,
+	},
+	{
+		name:     "trailing_dash_t",
+		line:     "-",
+		pattern:  "[a-]",
+		expected: true,
+	},
+	{
+		name:     "trailing_dash_f",
+		line:     "b",
+		pattern:  "[a-]",
+		expected: false,
+	},
+	{
+		name:     "escaped_dash_t",
+		line:     "-",
+		pattern:  "[a\\-z]",
+		expected: true,
+	},
+	{
+		name:     "escaped_dash_f",
+		line:     "m",
+		pattern:  "[a\\-z]",
+		expected: false,
+	},
+	{
+		name:     "range_to_escaped_t",
+		line:     "\\",
+		pattern:  "[!-\\\\]",
+		expected: true,
+	},
+	{
+		name:     "range_quantified_t",
+		line:     "2024-06-30",
+		pattern:  "^[0-9]{4}-[0-9]{2}-[0-9]{2}$",
+		expected: true,
+	},
+	{
+		name:     "posix_alpha_t",
+		line:     "123abc",
+		pattern:  "[[:alpha:]]",
+		expected: true,
+	},
+	{
+		name:     "posix_alpha_f",
+		line:     "123_!",
+		pattern:  "[[:alpha:]]",
+		expected: false,
+	},
+	{
+		name:     "posix_digit_t",
+		line:     "abc7",
+		pattern:  "[[:digit:]]",
+		expected: true,
+	},
+	{
+		name:     "posix_digit_f",
+		line:     "abc",
+		pattern:  "[[:digit:]]",
+		expected: false,
+	},
+	{
+		name:     "posix_alnum_t",
+		line:     "--x--",
+		pattern:  "[[:alnum:]]",
+		expected: true,
+	},
+	{
+		name:     "posix_alnum_f",
+		line:     "--_--",
+		pattern:  "[[:alnum:]]",
+		expected: false,
+	},
+	{
+		name:     "posix_space_t",
+		line:     "a\tb",
+		pattern:  "a[[:space:]]b",
+		expected: true,
+	},
+	{
+		name:     "posix_space_f",
+		line:     "a_b",
+		pattern:  "a[[:space:]]b",
+		expected: false,
+	},
+	{
+		name:     "posix_upper_t",
+		line:     "abC",
+		pattern:  "[[:upper:]]",
+		expected: true,
+	},
+	{
+		name:     "posix_upper_f",
+		line:     "abc",
+		pattern:  "[[:upper:]]",
+		expected: false,
+	},
+	{
+		name:     "posix_lower_t",
+		line:     "ABc",
+		pattern:  "[[:lower:]]",
+		expected: true,
+	},
+	{
+		name:     "posix_lower_f",
+		line:     "ABC",
+		pattern:  "[[:lower:]]",
+		expected: false,
+	},
+	{
+		name:     "posix_punct_t",
+		line:     "abc;",
+		pattern:  "[[:punct:]]",
+		expected: true,
+	},
+	{
+		name:     "posix_punct_f",
+		line:     "abc 1",
+		pattern:  "[[:punct:]]",
+		expected: false,
+	},
+	{
+		name:     "posix_xdigit_t",
+		line:     "0xBEEF",
+		pattern:  "^0x[[:xdigit:]]+$",
+		expected: true,
+	},
+	{
+		name:     "posix_xdigit_f",
+		line:     "0xBEEG",
+		pattern:  "^0x[[:xdigit:]]+$",
+		expected: false,
+	},
+	{
+		name:     "posix_print_t",
+		line:     "a b",
+		pattern:  "^[[:print:]]+$",
+		expected: true,
+	},
+	{
+		name:     "posix_print_f",
+		line:     "a\tb",
+		pattern:  "^[[:print:]]+$",
+		expected: false,
+	},
+	{
+		name:     "posix_graph_t",
+		line:     "a!b",
+		pattern:  "^[[:graph:]]+$",
+		expected: true,
+	},
+	{
+		name:     "posix_graph_f",
+		line:     "a b",
+		pattern:  "^[[:graph:]]+$",
+		expected: false,
+	},
+	{
+		name:     "posix_cntrl_t",
+		line:     "a\x07b",
+		pattern:  "[[:cntrl:]]",
+		expected: true,
+	},
+	{
+		name:     "posix_cntrl_f",
+		line:     "a b",
+		pattern:  "[[:cntrl:]]",
+		expected: false,
+	},
+	{
+		name:     "posix_blank_t",
+		line:     "a\tb",
+		pattern:  "a[[:blank:]]b",
+		expected: true,
+	},
+	{
+		name:     "posix_blank_f",
+		line:     "a\nb",
+		pattern:  "a[[:blank:]]b",
+		expected: false,
+	},
+	{
+		name:     "posix_negated_t",
+		line:     "   x  ",
+		pattern:  "[^[:space:]]",
+		expected: true,
+	},
+	{
+		name:     "posix_negated_f",
+		line:     " \t ",
+		pattern:  "[^[:space:]]",
+		expected: false,
+	},
+	{
+		name:     "posix_mixed_t",
+		line:     "key_1=on",
+		pattern:  "^[[:alpha:]_][[:alnum:]_]*=",
+		expected: true,
+	},
+	{
+		name:     "posix_mixed_f",
+		line:     "1key=on",
+		pattern:  "^[[:alpha:]_][[:alnum:]_]*=",
+		expected: false,
+	},
+	{
+		name:     "posix_with_range_t",
+		line:     "x-9",
+		pattern:  "^[[:upper:]a-z-]+[[:digit:]]$",
+		expected: true,
+	},
+	{
+		name:     "posix_not_a_class_t",
+		line:     "[:",
+		pattern:  "^[[:]+$",
+		expected: true,
+	},
+	{
+		name:     "space_t",
+		line:     "a b",
+		pattern:  "a\\sb",
+		expected: true,
+	},
+	{
+		name:     "space_tab_t",
+		line:     "a\tb",
+		pattern:  "a\\sb",
+		expected: true,
+	},
+	{
+		name:     "space_is_not_letter_s_f",
+		line:     "asb",
+		pattern:  "a\\sb",
+		expected: false,
+	},
+	{
+		name:     "not_space_t",
+		line:     "a b",
+		pattern:  "\\S",
+		expected: true,
+	},
+	{
+		name:     "not_space_f",
+		line:     " \t ",
+		pattern:  "\\S",
+		expected: false,
+	},
+	{
+		name:     "not_digit_t",
+		line:     "123x",
+		pattern:  "\\D",
+		expected: true,
+	},
+	{
+		name:     "not_digit_f",
+		line:     "123",
+		pattern:  "\\D",
+		expected: false,
+	},
+	{
+		name:     "not_word_t",
+		line:     "abc!",
+		pattern:  "\\W",
+		expected: true,
+	},
+	{
+		name:     "not_word_f",
+		line:     "ab_c9",
+		pattern:  "\\W",
+		expected: false,
+	},
+	{
+		name:     "horizontal_t",
+		line:     "a\tb",
+		pattern:  "a\\hb",
+		expected: true,
+	},
+	{
+		name:     "horizontal_f",
+		line:     "a\nb",
+		pattern:  "a\\hb",
+		expected: false,
+	},
+	{
+		name:     "not_horizontal_t",
+		line:     "a\nb",
+		pattern:  "a\\Hb",
+		expected: true,
+	},
+	{
+		name:     "vertical_t",
+		line:     "a\rb",
+		pattern:  "a\\vb",
+		expected: true,
+	},
+	{
+		name:     "vertical_f",
+		line:     "a b",
+		pattern:  "a\\vb",
+		expected: false,
+	},
+	{
+		name:     "not_vertical_t",
+		line:     "a b",
+		pattern:  "a\\Vb",
+		expected: true,
+	},
+	{
+		name:     "set_negated_shorthand_t",
+		line:     "x-y",
+		pattern:  "x[\\D]y",
+		expected: true,
+	},
+	{
+		name:     "set_negated_shorthand_f",
+		line:     "x5y",
+		pattern:  "x[\\D]y",
+		expected: false,
+	},
+	{
+		name:     "set_negated_and_chars_t",
+		line:     "x5y",
+		pattern:  "x[\\W5]y",
+		expected: true,
+	},
+	{
+		name:     "set_negated_and_chars_f",
+		line:     "x6y",
+		pattern:  "x[\\W5]y",
+		expected: false,
+	},
+	{
+		name:     "negated_set_negated_shorthand_t",
+		line:     "x5y",
+		pattern:  "x[^\\D]y",
+		expected: true,
+	},
+	{
+		name:     "negated_set_negated_shorthand_f",
+		line:     "xay",
+		pattern:  "x[^\\D]y",
+		expected: false,
+	},
+	{
+		name:     "control_escape_t",
+		line:     "a\tb",
+		pattern:  "a\\tb",
+		expected: true,
+	},
+	{
+		name:     "control_escape_f",
+		line:     "atb",
+		pattern:  "a\\tb",
+		expected: false,
+	},
+	{
+		name:     "escaped_punctuation_t",
+		line:     "a.b",
+		pattern:  "a\\.b",
+		expected: true,
+	},
+	{
+		name:     "escaped_punctuation_f",
+		line:     "axb",
+		pattern:  "a\\.b",
+		expected: false,
+	},
+	{
+		name:     "escaped_space_t",
+		line:     "a b",
+		pattern:  "a\\ b",
+		expected: true,
+	},
+	{
+		name:     "boundary_t",
+		line:     "call foo() now",
+		pattern:  "\\bfoo\\b",
+		expected: true,
+	},
+	{
+		name:     "boundary_prefix_f",
+		line:     "call foobar()",
+		pattern:  "\\bfoo\\b",
+		expected: false,
+	},
+	{
+		name:     "boundary_suffix_f",
+		line:     "call barfoo()",
+		pattern:  "\\bfoo\\b",
+		expected: false,
+	},
+	{
+		name:     "boundary_underscore_f",
+		line:     "my_foo",
+		pattern:  "\\bfoo",
+		expected: false,
+	},
+	{
+		name:     "boundary_line_ends_t",
+		line:     "foo",
+		pattern:  "^\\bfoo\\b$",
+		expected: true,
+	},
+	{
+		name:     "boundary_between_non_words_f",
+		line:     "a -- b",
+		pattern:  "-\\b-",
+		expected: false,
+	},
+	{
+		name:     "not_boundary_t",
+		line:     "foobar",
+		pattern:  "o\\Bb",
+		expected: true,
+	},
+	{
+		name:     "not_boundary_f",
+		line:     "foo bar",
+		pattern:  "o\\B b",
+		expected: false,
+	},
+	{
+		name:     "not_boundary_inside_word_t",
+		line:     "xfoo",
+		pattern:  "\\Bfoo",
+		expected: true,
+	},
+	{
+		name:     "not_boundary_at_start_f",
+		line:     "foo",
+		pattern:  "\\Bfoo",
+		expected: false,
+	},
+	{
+		name:     "boundary_in_group_t",
+		line:     "is it",
+		pattern:  "(\\bit\\b|nope)",
+		expected: true,
+	},
+	{
+		name:     "boundary_in_alternation_t",
+		line:     "bit",
+		pattern:  "(\\bit|b\\b)",
+		expected: false,
+	},
+	{
+		name:     "boundary_in_repeat_t",
+		line:     "ab cd ef",
+		pattern:  "^(\\w+\\b ?){3}$",
+		expected: true,
+	},
+	{
+		name:     "boundary_in_repeat_f",
+		line:     "abcd ef",
+		pattern:  "^(\\w\\w\\b ?){3}$",
+		expected: false,
+	},
+	{
+		name:     "inline_caseless_t",
+		line:     "HeLLo world",
+		pattern:  "(?i)hello",
+		expected: true,
+	},
+	{
+		name:     "inline_caseless_set_t",
+		line:     "xBCa",
+		pattern:  "^(?i)x[a-c]+$",
+		expected: true,
+	},
+	{
+		name:     "inline_caseless_negated_set_f",
+		line:     "K",
+		pattern:  "(?i)[^k]",
+		expected: false,
+	},
+	{
+		name:     "inline_caseless_class_unchanged_t",
+		line:     "A1",
+		pattern:  "(?i)\\w\\d",
+		expected: true,
+	},
+	{
+		name:     "inline_caseless_from_here_t",
+		line:     "aB",
+		pattern:  "a(?i)b",
+		expected: true,
+	},
+	{
+		name:     "inline_caseless_from_here_f",
+		line:     "AB",
+		pattern:  "a(?i)b",
+		expected: false,
+	},
+	{
+		name:     "inline_caseless_off_t",
+		line:     "Ab",
+		pattern:  "(?i)a(?-i)b",
+		expected: true,
+	},
+	{
+		name:     "inline_caseless_off_f",
+		line:     "AB",
+		pattern:  "(?i)a(?-i)b",
+		expected: false,
+	},
+	{
+		name:     "inline_caseless_ends_with_group_t",
+		line:     "Ab",
+		pattern:  "((?i)a)b",
+		expected: true,
+	},
+	{
+		name:     "inline_caseless_ends_with_group_f",
+		line:     "AB",
+		pattern:  "((?i)a)b",
+		expected: false,
+	},
+	{
+		name:     "inline_caseless_spans_alternatives_t",
+		line:     "xB",
+		pattern:  "x(a|(?i)c|b)",
+		expected: true,
+	},
+	{
+		name:     "scoped_caseless_t",
+		line:     "Ab",
+		pattern:  "(?i:a)b",
+		expected: true,
+	},
+	{
+		name:     "scoped_caseless_f",
+		line:     "AB",
+		pattern:  "(?i:a)b",
+		expected: false,
+	},
+	{
+		name:     "scoped_caseless_repeated_t",
+		line:     "aBAb!",
+		pattern:  "^(?i:ab)+!",
+		expected: true,
+	},
+	{
+		name:     "caseless_backref_t",
+		line:     "abAB",
+		pattern:  "(?i)(ab)\\1",
+		expected: true,
+	},
+	{
+		name:     "caseless_backref_f",
+		line:     "abAB",
+		pattern:  "(ab)\\1",
+		expected: false,
+	},
+	{
+		name:     "caseless_backref_only_where_set_f",
+		line:     "abAB",
+		pattern:  "(?i:(ab))\\1",
+		expected: false,
+	},
+	{
+		name:     "caret_in_group_t",
+		line:     "abc",
+		pattern:  "(^a|x)bc",
+		expected: true,
+	},
+	{
+		name:     "caret_in_group_f",
+		line:     "xabc",
+		pattern:  "(^a|y)bc",
+		expected: false,
+	},
+	{
+		name:     "dollar_in_group_t",
+		line:     "abc",
+		pattern:  "a(x|bc$)",
+		expected: true,
+	},
+	{
+		name:     "dollar_in_group_f",
+		line:     "abcd",
+		pattern:  "a(x|bc$)",
+		expected: false,
+	},
+	{
+		name:     "anchor_alternatives_start_t",
+		line:     "apple",
+		pattern:  "(^a|b$)",
+		expected: true,
+	},
+	{
+		name:     "anchor_alternatives_end_t",
+		line:     "crab",
+		pattern:  "(^a|b$)",
+		expected: true,
+	},
+	{
+		name:     "anchor_alternatives_f",
+		line:     "cabbage",
+		pattern:  "(^a|b$)",
+		expected: false,
+	},
+	{
+		name:     "caret_mid_pattern_f",
+		line:     "a^b",
+		pattern:  "a^b",
+		expected: false,
+	},
+	{
+		name:     "dollar_mid_pattern_f",
+		line:     "a$b",
+		pattern:  "a$b",
+		expected: false,
+	},
+	{
+		name:     "escaped_anchors_literal_t",
+		line:     "a^b$c",
+		pattern:  "a\\^b\\$c",
+		expected: true,
+	},
+	{
+		name:     "optional_anchor_group_t",
+		line:     "xab",
+		pattern:  "(^x)?ab$",
+		expected: true,
+	},
+	{
+		name:     "caret_after_flags_t",
+		line:     "ABC",
+		pattern:  "(?i)^abc$",
+		expected: true,
+	},
+	{
+		name:     "absolute_start_t",
+		line:     "foo bar",
+		pattern:  "\\Afoo",
+		expected: true,
+	},
+	{
+		name:     "absolute_start_f",
+		line:     "a foo",
+		pattern:  "\\Afoo",
+		expected: false,
+	},
+	{
+		name:     "absolute_end_t",
+		line:     "bar foo",
+		pattern:  "foo\\z",
+		expected: true,
+	},
+	{
+		name:     "absolute_end_f",
+		line:     "foo bar",
+		pattern:  "foo\\z",
+		expected: false,
+	},
+	{
+		name:     "absolute_end_newline_t",
+		line:     "bar foo",
+		pattern:  "foo\\Z",
+		expected: true,
+	},
+	{
+		name:     "lookahead_t",
+		line:     "width 100px",
+		pattern:  "\\d+(?=px)",
+		expected: true,
+	},
+	{
+		name:     "lookahead_f",
+		line:     "width 100em",
+		pattern:  "\\d+(?=px)",
+		expected: false,
+	},
+	{
+		name:     "negative_lookahead_t",
+		line:     "100px 200em",
+		pattern:  "\\d+(?!px|\\d)",
+		expected: true,
+	},
+	{
+		name:     "negative_lookahead_f",
+		line:     "100px 200px",
+		pattern:  "\\d+(?!px|\\d)",
+		expected: false,
+	},
+	{
+		name:     "lookaheads_all_hold_t",
+		line:     "abc123",
+		pattern:  "^(?=.*\\d)(?=.*[a-z]).{6,}$",
+		expected: true,
+	},
+	{
+		name:     "lookaheads_all_hold_f",
+		line:     "abcdef",
+		pattern:  "^(?=.*\\d)(?=.*[a-z]).{6,}$",
+		expected: false,
+	},
+	{
+		name:     "lookbehind_t",
+		line:     "cost $45",
+		pattern:  "(?<=\\$)\\d+",
+		expected: true,
+	},
+	{
+		name:     "lookbehind_f",
+		line:     "cost 45",
+		pattern:  "(?<=\\$)\\d+",
+		expected: false,
+	},
+	{
+		name:     "negative_lookbehind_t",
+		line:     "v1.2 and 3.4",
+		pattern:  "(?<!v)\\b\\d+\\.\\d",
+		expected: true,
+	},
+	{
+		name:     "negative_lookbehind_f",
+		line:     "v1.2 and v3.4",
+		pattern:  "(?<!v)\\b\\d+\\.\\d",
+		expected: false,
+	},
+	{
+		name:     "lookbehind_alternatives_t",
+		line:     "xbcd",
+		pattern:  "(?<=a|bc)d",
+		expected: true,
+	},
+	{
+		name:     "lookbehind_counted_t",
+		line:     "aab",
+		pattern:  "(?<=a{2,3})b",
+		expected: true,
+	},
+	{
+		name:     "lookbehind_counted_f",
+		line:     "ab",
+		pattern:  "(?<=a{2,3})b",
+		expected: false,
+	},
+	{
+		name:     "lookbehind_at_start_t",
+		line:     "x",
+		pattern:  "(?<=^|,)x",
+		expected: true,
+	},
+	{
+		name:     "nested_lookaround_t",
+		line:     "xab yab",
+		pattern:  "(?<=(?<!x)a)b",
+		expected: true,
+	},
+	{
+		name:     "nested_lookaround_f",
+		line:     "xab",
+		pattern:  "(?<=(?<!x)a)b",
+		expected: false,
+	},
+	{
+		name:     "lookahead_in_group_t",
+		line:     "ab",
+		pattern:  "(a(?=b)|c)",
+		expected: true,
+	},
+	{
+		name:     "lookahead_in_group_f",
+		line:     "ac",
+		pattern:  "(a(?=b)|x)",
+		expected: false,
+	},
+	{
+		name:     "non_capturing_t",
+		line:     "ababc",
+		pattern:  "^(?:ab)+c$",
+		expected: true,
+	},
+	{
+		name:     "non_capturing_f",
+		line:     "abac",
+		pattern:  "^(?:ab)+c$",
+		expected: false,
+	},
+	{
+		name:     "non_capturing_backref_t",
+		line:     "xyy",
+		pattern:  "(?:x)(y)\\1",
+		expected: true,
+	},
+	{
+		name:     "non_capturing_backref_f",
+		line:     "xyx",
+		pattern:  "(?:x)(y)\\1",
+		expected: false,
+	},
+	{
+		name:     "non_capturing_alternation_t",
+		line:     "cat",
+		pattern:  "^(?:dog|cat)$",
+		expected: true,
+	},
+	{
+		name:     "dot_skips_newline_f",
+		line:     "a\nb",
+		pattern:  "a.b",
+		expected: false,
+	},
+	{
+		name:     "dotall_group_t",
+		line:     "a\nb",
+		pattern:  "a(?s:.)b",
+		expected: true,
+	},
+	{
+		name:     "dotall_inline_t",
+		line:     "a\nb",
+		pattern:  "(?s)a.b",
+		expected: true,
+	},
+	{
+		name:     "dotall_off_f",
+		line:     "a\nb",
+		pattern:  "(?s)a(?-s).b",
+		expected: false,
+	},
+	{
+		name:     "combined_flags_t",
+		line:     "A\nB",
+		pattern:  "(?is:a.b)",
+		expected: true,
+	},
+	{
+		name:     "brace_not_a_count_t",
+		line:     "a{,3}",
+		pattern:  "a{,3}",
+		expected: true,
+	},
+	{
+		name:     "brace_not_a_count_f",
+		line:     "aaa",
+		pattern:  "a{x}",
+		expected: false,
+	},
+	{
+		name:     "hex_escape_t",
+		line:     "xAy",
+		pattern:  "x\\x41y",
+		expected: true,
+	},
+	{
+		name:     "hex_escape_braces_t",
+		line:     "a-b",
+		pattern:  "a\\x{2d}b",
+		expected: true,
+	},
+	{
+		name:     "hex_escape_in_set_f",
+		line:     "a b",
+		pattern:  "a[\\x{0}-\\x{1f}]b",
+		expected: false,
+	},
+}
+
+func TestRegexTableDriven(t *testing.T) {
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RegexTester(tt.line, tt.pattern); got != tt.expected {
+				t.Errorf("%s ~ /%s/ = %v; want %v", tt.line, tt.pattern, got, tt.expected)
+			}
+		})
+	}
+}
+
+// groupRepeatTests checks quantified groups through the offsets each group
+// captures, which must come from the final pass through the group
+var groupRepeatTests = []SubmatchInput{
+	{
+		name:    "plus",
+		line:    "xababx",
+		pattern: "(ab)+",
+		groups:  []int{1, 5, 3, 5},
+	},
+	{
+		name:    "plus_f",
+		line:    "xx",
+		pattern: "x(ab)+x",
+		groups:  nil,
+	},
+	{
+		name:    "star",
+		line:    "ababx",
+		pattern: "(ab)*x",
+		groups:  []int{0, 5, 2, 4},
+	},
+	{
+		name:    "star_zero",
+		line:    "x",
+		pattern: "(ab)*",
+		groups:  []int{0, 0, -1, -1},
+	},
+	{
+		name:    "star_zero_mid",
+		line:    "xy",
+		pattern: "x(ab)*y",
+		groups:  []int{0, 2, -1, -1},
+	},
+	{
+		name:    "question",
+		line:    "abx",
+		pattern: "(ab)?x",
+		groups:  []int{0, 3, 0, 2},
+	},
+	{
+		name:    "question_zero",
+		line:    "xy",
+		pattern: "x(ab)?y",
+		groups:  []int{0, 2, -1, -1},
+	},
+	{
+		name:    "question_f",
+		line:    "xababy",
+		pattern: "^x(ab)?y$",
+		groups:  nil,
+	},
+	{
+		name:    "alternation_star",
+		line:    "abac",
+		pattern: "(a|b)*c",
+		groups:  []int{0, 4, 2, 3},
+	},
+	{
+		name:    "last_pass",
+		line:    "hello",
+		pattern: "(\\w)+",
+		groups:  []int{0, 5, 4, 5},
+	},
+	{
+		name:    "nested",
+		line:    "abcbcaac",
+		pattern: "((a|b)+c)*",
+		groups:  []int{0, 8, 5, 8, 6, 7},
+	},
+	{
+		name:    "nested_zero",
+		line:    "abcbcad",
+		pattern: "((a|b)+c)*d",
+		groups:  []int{6, 7, -1, -1, -1, -1},
+	},
+	{
+		name:    "nested_inner_counts_reset",
+		line:    "abcbac",
+		pattern: "^((a|b){2}c)+$",
+		groups:  []int{0, 6, 3, 6, 4, 5},
+	},
+	{
+		name:    "nested_inner_counts_reset_f",
+		line:    "abcbc",
+		pattern: "^((a|b){2}c)+$",
+		groups:  nil,
+	},
+	{
+		name:    "nested_optional_inner",
+		line:    "xyx",
+		pattern: "(x(y)?)+",
+		groups:  []int{0, 3, 2, 3, 1, 2},
+	},
+	{
+		name:    "inner_capture_persists",
+		line:    "abc",
+		pattern: "((ab)|c)+",
+		groups:  []int{0, 3, 2, 3, 0, 2},
+	},
+	{
+		name:    "inner_capture_updated",
+		line:    "abcab",
+		pattern: "((ab)|c)+",
+		groups:  []int{0, 5, 3, 5, 3, 5},
+	},
+	{
+		name:    "optional_inner_keeps_earlier",
+		line:    "aba",
+		pattern: "((a)(b)?)+",
+		groups:  []int{0, 3, 2, 3, 2, 3, 1, 2},
+	},
+	{
+		name:    "zero_passes_unset",
+		line:    "b",
+		pattern: "(a)*b",
+		groups:  []int{0, 1, -1, -1},
+	},
+	{
+		name:    "gives_back_pass",
+		line:    "ababab",
+		pattern: "(ab)*ab",
+		groups:  []int{0, 6, 2, 4},
+	},
+	{
+		name:    "gives_back_inside",
+		line:    "aabbac",
+		pattern: "(a+|b+)*c",
+		groups:  []int{0, 6, 4, 5},
+	},
+	{
+		name:    "anchored_plus",
+		line:    "aaaa",
+		pattern: "^(a+)+$",
+		groups:  []int{0, 4, 0, 4},
+	},
+	{
+		name:    "counted_inner_star",
+		line:    "aaaaa",
+		pattern: "(a{2})*",
+		groups:  []int{0, 4, 2, 4},
+	},
+	{
+		name:    "dot_star_group",
+		line:    "abc",
+		pattern: "(.)*",
+		groups:  []int{0, 3, 2, 3},
+	},
+	{
+		name:    "empty_pass_star",
+		line:    "b",
+		pattern: "(a*)*",
+		groups:  []int{0, 0, 0, 0},
+	},
+	{
+		name:    "empty_pass_after_text",
+		line:    "aaa",
+		pattern: "(a*)*",
+		groups:  []int{0, 3, 3, 3},
+	},
+	{
+		name:    "empty_pass_plus",
+		line:    "b",
+		pattern: "(a*)+",
+		groups:  []int{0, 0, 0, 0},
+	},
+	{
+		name:    "empty_pass_question_plus",
+		line:    "aa",
+		pattern: "(a?)+",
+		groups:  []int{0, 2, 2, 2},
+	},
+	{
+		name:    "empty_pass_before_b",
+		line:    "aab",
+		pattern: "(a*)+b",
+		groups:  []int{0, 3, 2, 2},
+	},
+	{
+		name:    "empty_pass_star_b",
+		line:    "aab",
+		pattern: "(a*)*b",
+		groups:  []int{0, 3, 2, 2},
+	},
+	{
+		name:    "empty_min_passes",
+		line:    "",
+		pattern: "^(a*){3}$",
+		groups:  []int{0, 0, 0, 0},
+	},
+	{
+		name:    "empty_min_then_text",
+		line:    "aab",
+		pattern: "^(a*){2,}b",
+		groups:  []int{0, 3, 2, 2},
+	},
+	{
+		name:    "nested_empty",
+		line:    "aa",
+		pattern: "((a*)*)*",
+		groups:  []int{0, 2, 2, 2, 2, 2},
+	},
+	{
+		name:    "group_star_backref",
+		line:    "abc-c",
+		pattern: "(\\w)*-\\1",
+		groups:  []int{0, 5, 2, 3},
+	},
+	{
+		name:    "group_star_backref_f",
+		line:    "abc-a",
+		pattern: "^(\\w)*-\\1$",
+		groups:  nil,
+	},
+	{
+		name:    "lazy_star",
+		line:    "abc",
+		pattern: "(a|b)*?c",
+		groups:  []int{0, 3, 1, 2},
+	},
+	{
+		name:    "whole_line",
+		line:    "1,22,333",
+		pattern: "^(\\d+,)*\\d+$",
+		groups:  []int{0, 8, 2, 5},
+	},
+	{
+		name:    "whole_line_f",
+		line:    "1,22,",
+		pattern: "^(\\d+,)*\\d+$",
+		groups:  nil,
+	},
+	{
+		name:    "empty_pass_then_repeat",
+		line:    "b",
+		pattern: "(b?)*(a)*",
+		groups:  []int{0, 1, 1, 1, -1, -1},
+	},
+	{
+		name:    "empty_pass_then_repeated_assertion",
+		line:    "a",
+		pattern: "(a*)+(?:\\b)+",
+		groups:  []int{0, 1, 1, 1},
+	},
+}
+
+func TestGroupRepeat(t *testing.T) {
+	for _, tt := range groupRepeatTests {
+		t.Run(tt.name, func(t *testing.T) {
+			regex := MustCompile(tt.pattern)
+			if got := regex.FindSubmatchIndex([]byte(tt.line)); !reflect.DeepEqual(got, tt.groups) {
+				t.Errorf("FindSubmatchIndex(%q) with /%s/ = %v; want %v", tt.line, tt.pattern, got, tt.groups)
+			}
+		})
+	}
+}
+
+// The concurrency tests share compiled patterns between goroutines, so run
+// them with -race: any match state written into the pattern graph shows up
+// there even when the answers happen to come out right.
+
+func TestConcurrentBackrefs(t *testing.T) {
+	regex := MustCompile("(\\w+) and (\\w+) and \\2 and \\1")
+	lines := []RegexInput{
+		{line: "cat and dog and dog and cat", expected: true},
+		{line: "red and blue and blue and red", expected: true},
+		{line: "cat and dog and cat and dog", expected: false},
+		{line: "one and two and two and one!", expected: true},
+		{line: "sun and moon and moon and stars", expected: false},
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				tt := lines[(g+i)%len(lines)]
+				if got := regex.MatchLine([]byte(tt.line)); got != tt.expected {
+					t.Errorf("%s ~ /%s/ = %v; want %v", tt.line, regex, got, tt.expected)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentTable(t *testing.T) {
+	compiled := make([]*RegExp, len(tests))
+	for i, tt := range tests {
+		compiled[i] = MustCompile(tt.pattern)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, tt := range tests {
+				if got := compiled[i].MatchLine([]byte(tt.line)); got != tt.expected {
+					t.Errorf("%s ~ /%s/ = %v; want %v", tt.line, tt.pattern, got, tt.expected)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+type CompileErrorInput struct {
+	name    string
+	pattern string
+	code    ErrorCode
+	offset  int
+}
+
+var compileErrorTests = []CompileErrorInput{
+	{
+		name:    "empty",
+		pattern: "",
+		code:    ErrEmptyPattern,
+		offset:  0,
+	},
+	{
+		name:    "unclosed_set",
+		pattern: "ab[cd",
+		code:    ErrMissingBracket,
+		offset:  2,
+	},
+	{
+		name:    "unclosed_group",
+		pattern: "a(b|c",
+		code:    ErrMissingParen,
+		offset:  1,
+	},
+	{
+		name:    "unclosed_group_after_caret",
+		pattern: "^(ab",
+		code:    ErrMissingParen,
+		offset:  1,
+	},
+	{
+		name:    "trailing_backslash",
+		pattern: "ab\\",
+		code:    ErrTrailingBackslash,
+		offset:  2,
+	},
+	{
+		name:    "backref_err",
+		pattern: "the cat is a \\1", // there is no group
+		code:    ErrInvalidBackref,
+		offset:  13,
+	},
+	{
+		name:    "backref_past_groups",
+		pattern: "(a)(b)\\3",
+		code:    ErrInvalidBackref,
+		offset:  6,
+	},
+	{
+		name:    "bad_group_name",
+		pattern: "x(?P<my-name>a)",
+		code:    ErrInvalidGroupName,
+		offset:  1,
+	},
+	{
+		name:    "unclosed_group_name",
+		pattern: "(?<name",
+		code:    ErrInvalidGroupName,
+		offset:  0,
+	},
+	{
+		name:    "empty_group_name",
+		pattern: "(?P<>a)",
+		code:    ErrInvalidGroupName,
+		offset:  0,
+	},
+	{
+		name:    "duplicate_group_name",
+		pattern: "(?<a>x)(?P<a>y)",
+		code:    ErrDuplicateName,
+		offset:  7,
+	},
+	{
+		name:    "unknown_named_backref",
+		pattern: "(?<a>x)\\k<b>",
+		code:    ErrInvalidBackref,
+		offset:  7,
+	},
+	{
+		name:    "named_backref_without_name",
+		pattern: "(?<a>x)\\ka",
+		code:    ErrInvalidBackref,
+		offset:  7,
+	},
+	{
+		name:    "inverted_repeat",
+		pattern: "xa{3,2}",
+		code:    ErrInvalidRepeatSize,
+		offset:  2,
+	},
+	{
+		name:    "repeat_over_limit",
+		pattern: "a{1001}",
+		code:    ErrRepeatTooLarge,
+		offset:  1,
+	},
+	{
+		name:    "nested_repeat_over_limit",
+		pattern: "(a{1000}){1000}",
+		code:    ErrRepeatTooLarge,
+		offset:  9,
+	},
+	{
+		name:    "nested_repeat_over_limit_deep",
+		pattern: "((a{10}b){10}c){11}",
+		code:    ErrRepeatTooLarge,
+		offset:  15,
+	},
+	{
+		name:    "reversed_range",
+		pattern: "x[az-a]",
+		code:    ErrInvalidCharRange,
+		offset:  3,
+	},
+	{
+		name:    "range_to_shorthand",
+		pattern: "[a-\\d]",
+		code:    ErrInvalidCharRange,
+		offset:  1,
+	},
+	{
+		name:    "only_bracket_in_set",
+		pattern: "[]",
+		code:    ErrMissingBracket,
+		offset:  0,
+	},
+	{
+		name:    "escaped_close_in_set",
+		pattern: "a[b\\]",
+		code:    ErrMissingBracket,
+		offset:  1,
+	},
+	{
+		name:    "unknown_posix_class",
+		pattern: "a[[:word:]]",
+		code:    ErrInvalidCharClass,
+		offset:  2,
+	},
+	{
+		name:    "posix_class_range_end",
+		pattern: "[a-[:digit:]]",
+		code:    ErrInvalidCharRange,
+		offset:  1,
+	},
+	{
+		name:    "unknown_escape",
+		pattern: "ab\\q",
+		code:    ErrInvalidEscape,
+		offset:  2,
+	},
+	{
+		name:    "unknown_escape_in_set",
+		pattern: "[a\\y]",
+		code:    ErrInvalidEscape,
+		offset:  2,
+	},
+	{
+		name:    "escaped_zero",
+		pattern: "a\\0",
+		code:    ErrInvalidEscape,
+		offset:  1,
+	},
+	{
+		name:    "unknown_property",
+		pattern: "x\\p{Klingon}",
+		code:    ErrInvalidCharClass,
+		offset:  1,
+	},
+	{
+		name:    "unclosed_property",
+		pattern: "\\p{Lu",
+		code:    ErrInvalidCharClass,
+		offset:  0,
+	},
+	{
+		name:    "property_missing_name",
+		pattern: "a\\p",
+		code:    ErrInvalidCharClass,
+		offset:  1,
+	},
+	{
+		name:    "unknown_property_in_set",
+		pattern: "[a\\pQ]",
+		code:    ErrInvalidCharClass,
+		offset:  2,
+	},
+	{
+		name:    "property_as_range_end",
+		pattern: "[a-\\pL]",
+		code:    ErrInvalidCharRange,
+		offset:  1,
+	},
+	{
+		name:    "unknown_flag",
+		pattern: "a(?z)",
+		code:    ErrInvalidPerlOp,
+		offset:  1,
+	},
+	{
+		name:    "unclosed_flags",
+		pattern: "(?i",
+		code:    ErrInvalidPerlOp,
+		offset:  0,
+	},
+	{
+		name:    "no_flags",
+		pattern: "(?)",
+		code:    ErrInvalidPerlOp,
+		offset:  0,
+	},
+	{
+		name:    "dangling_flag_minus",
+		pattern: "(?i-)",
+		code:    ErrInvalidPerlOp,
+		offset:  0,
+	},
+	{
+		name:    "unclosed_flag_group",
+		pattern: "(?i:ab",
+		code:    ErrMissingParen,
+		offset:  0,
+	},
+	{
+		name:    "unbounded_lookbehind",
+		pattern: "x(?<=a+)b",
+		code:    ErrInvalidLookbehind,
+		offset:  1,
+	},
+	{
+		name:    "lookbehind_with_backref",
+		pattern: "(a)(?<=\\1)",
+		code:    ErrInvalidLookbehind,
+		offset:  3,
+	},
+	{
+		name:    "unclosed_lookahead",
+		pattern: "a(?=b",
+		code:    ErrMissingParen,
+		offset:  1,
+	},
+	{
+		name:    "unclosed_non_capturing_group",
+		pattern: "(?:ab",
+		code:    ErrMissingParen,
+		offset:  0,
+	},
+	{
+		name:    "unknown_perl_group",
+		pattern: "(?#comment)",
+		code:    ErrInvalidPerlOp,
+		offset:  0,
+	},
+	{
+		name:    "short_hex_escape",
+		pattern: "ab\\x4",
+		code:    ErrInvalidEscape,
+		offset:  2,
+	},
+	{
+		name:    "hex_escape_past_a_byte",
+		pattern: "a\\x{100}",
+		code:    ErrInvalidEscape,
+		offset:  1,
+	},
+	{
+		name:    "hex_escape_not_hex",
+		pattern: "[\\x{4g}]",
+		code:    ErrInvalidEscape,
+		offset:  1,
+	},
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, tt := range compileErrorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			regex, err := Compile(tt.pattern)
+			if err == nil {
+				t.Fatalf("Compile(%q) = %s; want error %q", tt.pattern, regex, tt.code)
+			}
+			var serr *SyntaxError
+			if !errors.As(err, &serr) {
+				t.Fatalf("Compile(%q) error %v is not a *SyntaxError", tt.pattern, err)
+			}
+			if serr.Code != tt.code || serr.Offset != tt.offset {
+				t.Errorf("Compile(%q) = %q at %d; want %q at %d", tt.pattern, serr.Code, serr.Offset, tt.code, tt.offset)
+			}
+		})
+	}
+}
+
+func TestMaxRepeatOption(t *testing.T) {
+	opts := CompileOptions{MaxRepeat: 10}
+	for pattern, ok := range map[string]bool{
+		"a{10}":        true,
+		"a{11}":        false,
+		"a{2,}":        true,
+		"(a{5}){2}":    true,
+		"(a{5}){3}":    false,
+		"(a{5}b)*c{9}": true,
+		"(x(a{5}))+":   true,
+	} {
+		_, err := CompileWithOptions(pattern, opts)
+		if (err == nil) != ok {
+			t.Errorf("CompileWithOptions(%q, %+v) error = %v; want ok=%v", pattern, opts, err, ok)
+		}
+	}
+	if _, err := Compile("(a{10}){100}"); err != nil {
+		t.Errorf("Compile(%q) = %v; want it within the default limit", "(a{10}){100}", err)
+	}
+}
+
+// utf8Tests are matched in UTF-8 mode, and should all come out differently
+// when every byte is taken as a character of its own
+var utf8Tests = []RegexInput{
+	{
+		name:     "dot_takes_whole_rune_t",
+		line:     "aéb",
+		pattern:  "a.b",
+		expected: true,
+	},
+	{
+		name:     "single_rune_line_t",
+		line:     "ø",
+		pattern:  "^.$",
+		expected: true,
+	},
+	{
+		name:     "set_of_runes_t",
+		line:     "é",
+		pattern:  "^[éè]$",
+		expected: true,
+	},
+	{
+		name:     "set_ignores_stray_continuation_byte_f",
+		line:     "\xa9",
+		pattern:  "^[éè]$",
+		expected: false,
+	},
+	{
+		name:     "negated_set_takes_whole_rune_t",
+		line:     "é",
+		pattern:  "^[^a]$",
+		expected: true,
+	},
+	{
+		name:     "quantifier_repeats_rune_t",
+		line:     "ééé",
+		pattern:  "^é+$",
+		expected: true,
+	},
+	{
+		name:     "counted_runes_t",
+		line:     "日本語",
+		pattern:  "^.{3}$",
+		expected: true,
+	},
+	{
+		name:     "unicode_word_t",
+		line:     "café",
+		pattern:  "^\\w+$",
+		expected: true,
+	},
+	{
+		name:     "unicode_not_word_f",
+		line:     "é",
+		pattern:  "\\W",
+		expected: false,
+	},
+	{
+		name:     "unicode_word_boundary_f",
+		line:     "café",
+		pattern:  "\\bcaf\\b",
+		expected: false,
+	},
+	{
+		name:     "hex_escape_rune_t",
+		line:     "café",
+		pattern:  "caf\\x{e9}",
+		expected: true,
+	},
+}
+
+func TestUTF8Mode(t *testing.T) {
+	for _, tt := range utf8Tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regex, err := CompileWithOptions(tt.pattern, CompileOptions{UTF8: true})
+			if err != nil {
+				t.Fatalf("CompileWithOptions(%q) = %v", tt.pattern, err)
+			}
+			if got := regex.MatchLine([]byte(tt.line)); got != tt.expected {
+				t.Errorf("MatchLine(%q) = %v; want %v", tt.line, got, tt.expected)
+			}
+			if got := RegexTester(tt.line, tt.pattern); got == tt.expected {
+				t.Errorf("byte mode MatchLine(%q) = %v; want %v", tt.line, got, !tt.expected)
+			}
+		})
+	}
+}
+
+func TestUTF8InvalidInput(t *testing.T) {
+	// each byte of an invalid sequence is a character, matching U+FFFD
+	for pattern, line := range map[string]string{
+		"^a.b$":    "a\xffb",
+		"^a..b$":   "a\xe9\x80b",
+		"^[^x]$":   "\xff",
+		"^\uFFFD$": "\xff",
+		"^\\W$":    "\xff",
+	} {
+		regex, err := CompileWithOptions(pattern, CompileOptions{UTF8: true})
+		if err != nil {
+			t.Fatalf("CompileWithOptions(%q) = %v", pattern, err)
+		}
+		if !regex.MatchLine([]byte(line)) {
+			t.Errorf("%q does not match %q", pattern, line)
+		}
+	}
+
+	_, err := CompileWithOptions("a\xffb", CompileOptions{UTF8: true})
+	var serr *SyntaxError
+	if !errors.As(err, &serr) || serr.Code != ErrInvalidUTF8 || serr.Offset != 1 {
+		t.Errorf("CompileWithOptions(%q) = %v; want %q at offset 1", "a\xffb", err, ErrInvalidUTF8)
+	}
+	if _, err := Compile("a\xffb"); err != nil {
+		t.Errorf("Compile(%q) = %v; want it accepted in byte mode", "a\xffb", err)
+	}
+}
+
+// propertyTests are matched in UTF-8 mode
+var propertyTests = []RegexInput{
+	{
+		name:     "letter_t",
+		line:     "Zoë",
+		pattern:  "^\\p{L}+$",
+		expected: true,
+	},
+	{
+		name:     "letter_f",
+		line:     "Zoë3",
+		pattern:  "^\\p{L}+$",
+		expected: false,
+	},
+	{
+		name:     "one_letter_name_t",
+		line:     "x٣",
+		pattern:  "x\\pN",
+		expected: true,
+	},
+	{
+		name:     "upper_t",
+		line:     "élan Émile",
+		pattern:  "\\p{Lu}\\p{Ll}+",
+		expected: true,
+	},
+	{
+		name:     "upper_f",
+		line:     "élan émile",
+		pattern:  "\\p{Lu}",
+		expected: false,
+	},
+	{
+		name:     "script_t",
+		line:     "alpha is α",
+		pattern:  "\\p{Greek}",
+		expected: true,
+	},
+	{
+		name:     "script_f",
+		line:     "alpha is a",
+		pattern:  "\\p{Greek}",
+		expected: false,
+	},
+	{
+		name:     "han_t",
+		line:     "user 王小明 logged in",
+		pattern:  "user \\p{Han}{3} ",
+		expected: true,
+	},
+	{
+		name:     "negated_t",
+		line:     "日本 ",
+		pattern:  "^\\p{Han}+\\P{Han}$",
+		expected: true,
+	},
+	{
+		name:     "negated_f",
+		line:     "日本",
+		pattern:  "\\P{Han}",
+		expected: false,
+	},
+	{
+		name:     "caret_negated_t",
+		line:     "α1",
+		pattern:  "^\\p{Greek}\\p{^Greek}$",
+		expected: true,
+	},
+	{
+		name:     "double_negated_t",
+		line:     "α",
+		pattern:  "^\\P{^Greek}$",
+		expected: true,
+	},
+	{
+		name:     "any_t",
+		line:     "\t",
+		pattern:  "^\\p{Any}$",
+		expected: true,
+	},
+	{
+		name:     "in_set_t",
+		line:     "Σ-9",
+		pattern:  "^[\\p{Lu}\\d-]+$",
+		expected: true,
+	},
+	{
+		name:     "in_set_f",
+		line:     "σ",
+		pattern:  "[\\p{Lu}\\d-]",
+		expected: false,
+	},
+	{
+		name:     "negated_in_set_t",
+		line:     "ab.",
+		pattern:  "[\\PL]",
+		expected: true,
+	},
+	{
+		name:     "negated_in_negated_set_f",
+		line:     "12a",
+		pattern:  "^[^\\PL]",
+		expected: false,
+	},
+}
+
+func TestUnicodeProperties(t *testing.T) {
+	for _, tt := range propertyTests {
+		t.Run(tt.name, func(t *testing.T) {
+			regex, err := CompileWithOptions(tt.pattern, CompileOptions{UTF8: true})
+			if err != nil {
+				t.Fatalf("CompileWithOptions(%q) = %v", tt.pattern, err)
+			}
+			if got := regex.MatchLine([]byte(tt.line)); got != tt.expected {
+				t.Errorf("MatchLine(%q) = %v; want %v", tt.line, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestStringRoundTrip compiles what String gives back for each pattern in
+// the tables, which has to parse to the same tree and match the same way
+func TestStringRoundTrip(t *testing.T) {
+	check := func(t *testing.T, pattern string, line string, opts CompileOptions) {
+		regex, err := CompileWithOptions(pattern, opts)
+		if err != nil {
+			t.Fatalf("CompileWithOptions(%q) = %v", pattern, err)
+		}
+		printed := regex.String()
+		again, err := CompileWithOptions(printed, CompileOptions{UTF8: opts.UTF8})
+		if err != nil {
+			t.Fatalf("CompileWithOptions(%q), printed from /%s/, = %v", printed, pattern, err)
+		}
+		if !reflect.DeepEqual(again.tree, regex.tree) {
+			t.Errorf("/%s/ printed as /%s/ parses to a different tree", pattern, printed)
+		}
+		got := again.FindAllSubmatchIndex([]byte(line), -1)
+		want := regex.FindAllSubmatchIndex([]byte(line), -1)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("FindAllSubmatchIndex(%q) with /%s/ = %v; /%s/ gives %v", line, printed, got, pattern, want)
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { check(t, tt.pattern, tt.line, CompileOptions{}) })
+	}
+	for _, tt := range groupRepeatTests {
+		t.Run(tt.name, func(t *testing.T) { check(t, tt.pattern, tt.line, CompileOptions{}) })
+	}
+	for _, tt := range append(slices.Clone(utf8Tests), propertyTests...) {
+		t.Run(tt.name, func(t *testing.T) { check(t, tt.pattern, tt.line, CompileOptions{UTF8: true}) })
+	}
+	// the option has to be written into the printed pattern
+	for _, pattern := range []string{"hello", "h(?-i:e)llo", "[^k]", "(a)\\1"} {
+		t.Run(pattern, func(t *testing.T) {
+			check(t, pattern, "HELLO hello K k aA", CompileOptions{UTF8: true, CaseInsensitive: true})
+		})
+	}
+}
+
+// TestSimplifyAgrees runs each pattern as parsed, without simplifying it,
+// which has to find the same matches and groups
+func TestSimplifyAgrees(t *testing.T) {
+	check := func(t *testing.T, pattern string, line string, opts CompileOptions) {
+		regex, err := CompileWithOptions(pattern, opts)
+		if err != nil {
+			t.Fatalf("CompileWithOptions(%q) = %v", pattern, err)
+		}
+		tree, err := syntax.Parse(pattern, syntax.Options{UTF8: opts.UTF8})
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", pattern, err)
+		}
+		plain := compile(tree, opts.UTF8)
+		for _, re := range []*RegExp{regex, backtracking(regex)} {
+			got := re.FindAllSubmatchIndex([]byte(line), -1)
+			want := plain.FindAllSubmatchIndex([]byte(line), -1)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("FindAllSubmatchIndex(%q) with /%s/ simplified to /%s/ = %v; want %v", line, pattern, re, got, want)
+			}
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { check(t, tt.pattern, tt.line, CompileOptions{}) })
+	}
+	for _, tt := range append(slices.Clone(submatchTests), groupRepeatTests...) {
+		t.Run(tt.name, func(t *testing.T) { check(t, tt.pattern, tt.line, CompileOptions{}) })
+	}
+	for _, tt := range append(slices.Clone(utf8Tests), propertyTests...) {
+		t.Run(tt.name, func(t *testing.T) { check(t, tt.pattern, tt.line, CompileOptions{UTF8: true}) })
+	}
+	for _, tt := range []struct {
+		pattern string
+		line    string
+	}{
+		{"(?:abc|abd|ab)e", "abe abce abde abcd"},
+		{"(?:a|ab)(c|bcd)", "abcd"},
+		{"(?:ab|a)(c|bcd)", "abcd"},
+		{"x(?:a|b|[0-9]|c)+y", "xa1by xy x9y"},
+		{"(?:a*)*b", "aaab b"},
+		{"(?:a+)?(a*)", "aaa"},
+		{"(?:a+?)+?b", "aab"},
+		{"(a*)*b", "aab"},
+		{"(?:(?i:ab)|abc)d", "ABd abcd"},
+		{"(?:foo|foobar|fo)(bar)?", "foobar"},
+		{"x{1}(?:y{1})+", "xyy"},
+	} {
+		t.Run(tt.pattern, func(t *testing.T) { check(t, tt.pattern, tt.line, CompileOptions{}) })
+	}
+}
+
+func TestCaseInsensitiveOption(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		line    string
+		utf8    bool
+		want    bool
+	}{
+		{"hello", "HELLO", false, true},
+		{"(?-i)hello", "HELLO", false, false},
+		{"h(?-i:e)llo", "HELLO", false, false},
+		{"[[:lower:]]+", "ABC", false, true},
+		// outside UTF-8 mode only ASCII letters have cases
+		{"é", "É", false, false},
+		{"é", "É", true, true},
+		{"straße", "STRASSE", true, false},
+		{"k", "\u212a", true, true},
+		{"^s$", "\u017f", true, true},
+		{"\\p{Lu}", "a", true, true},
+		{"(é)\\1", "éÉ", true, true},
+		{"(k)\\1", "k\u212a", true, true},
+	} {
+		opts := CompileOptions{CaseInsensitive: true, UTF8: tt.utf8}
+		regex, err := CompileWithOptions(tt.pattern, opts)
+		if err != nil {
+			t.Fatalf("CompileWithOptions(%q, %+v) = %v", tt.pattern, opts, err)
+		}
+		if got := regex.MatchLine([]byte(tt.line)); got != tt.want {
+			t.Errorf("CompileWithOptions(%q, %+v).MatchLine(%q) = %v; want %v", tt.pattern, opts, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestMustCompilePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("MustCompile(\"(ab\") did not panic")
+		}
+	}()
+	MustCompile("(ab")
 }
@@ -0,0 +1,904 @@
+package syntax
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMaxRepeat is the repeat limit used when Options leaves it unset
+const DefaultMaxRepeat = 1000
+
+// Options adjusts how Parse reads a pattern
+type Options struct {
+	// MaxRepeat limits the counts in {n}, {n,} and {n,m}. Counts on nested
+	// groups multiply, so (a{10}){100} counts as 1000 against the limit.
+	// Zero means DefaultMaxRepeat.
+	MaxRepeat int
+
+	// UTF8 reads the pattern as UTF-8, refusing it if it is not valid.
+	// Without it every byte is a character, taken as the rune with the same
+	// value, and classes hold nothing past U+00FF.
+	UTF8 bool
+
+	// CaseInsensitive starts the pattern off as if it began with (?i). Case
+	// is folded using Unicode simple folding in UTF-8 mode, and for ASCII
+	// letters alone otherwise.
+	CaseInsensitive bool
+}
+
+// Parse parses pattern into a tree. Malformed patterns are reported as an
+// *Error.
+//
+// Capturing groups are numbered in the order they open. Groups that do not
+// capture are left out, and so are the flags set by (?i) and the like, which
+// are applied to the nodes as they are made.
+func Parse(pattern string, opts Options) (Node, error) {
+	if opts.MaxRepeat == 0 {
+		opts.MaxRepeat = DefaultMaxRepeat
+	}
+	if len(pattern) == 0 {
+		return nil, &Error{Code: ErrEmptyPattern, Expr: pattern, Offset: 0}
+	}
+	p := &parser{
+		pattern: pattern,
+		opts:    opts,
+		flags:   flags{caseless: opts.CaseInsensitive},
+		weight:  1,
+	}
+	subs, err := p.parseConcat(false)
+	if err != nil {
+		return nil, err
+	}
+	return concat(subs), nil
+}
+
+// concat returns the node for subs one after the other
+func concat(subs []Node) Node {
+	if len(subs) == 1 {
+		return subs[0]
+	}
+	return &Concat{Subs: subs}
+}
+
+// alternate returns the node for a choice between subs
+func alternate(subs []Node) Node {
+	if len(subs) == 1 {
+		return subs[0]
+	}
+	return &Alternate{Subs: subs}
+}
+
+// flags are the settings switched on and off by (?i) and the like
+type flags struct {
+	caseless   bool // i
+	multiline  bool // m: ^ and $ match at newlines as well
+	dotNewline bool // s: . matches a newline as well
+}
+
+// parser holds the state of a single Parse
+type parser struct {
+	pattern string
+	pos     int // offset of the byte being read
+	opts    Options
+	flags   flags    // in force at pos
+	names   []string // of the capturing groups opened so far
+	// the largest repeat count seen in the group being parsed, with counts on
+	// nested groups multiplied out, to hold (a{1000}){1000} to the limit
+	weight int
+}
+
+// parseConcat reads nodes up to the end of the pattern, or inside a group up
+// to the | or ) that ends the alternative. A | or ) outside any group is
+// taken literally.
+func (p *parser) parseConcat(inGroup bool) ([]Node, error) {
+	subs := []Node{}
+	for p.pos < len(p.pattern) {
+		var n Node
+		var err error
+		switch p.pattern[p.pos] {
+		case '[':
+			n, err = p.parseSet()
+			if err == nil {
+				n, err = p.quantify(n, 1)
+			}
+
+		case '(':
+			n, err = p.parseParen()
+
+		case '|', ')':
+			if inGroup {
+				return subs, nil
+			}
+			n, err = p.quantify(p.literal(rune(p.pattern[p.pos])), 1)
+
+		case '^':
+			n = &Assertion{Kind: TextStart}
+			if p.flags.multiline {
+				n = &Assertion{Kind: LineStart}
+			}
+
+		case '$':
+			n = &Assertion{Kind: TextEnd}
+			if p.flags.multiline {
+				n = &Assertion{Kind: LineEnd}
+			}
+
+		case '.':
+			dot := p.class([]Range{{'\n', '\n'}}, true)
+			if p.flags.dotNewline {
+				dot = p.class(nil, true)
+			}
+			n, err = p.quantify(dot, 1)
+
+		case '\\':
+			n, err = p.parseEscape()
+
+		default:
+			var c rune
+			var size int
+			c, size, err = patternChar(p.pattern, p.pos, p.opts.UTF8)
+			if err != nil {
+				return nil, err
+			}
+			p.pos += size - 1
+			n, err = p.quantify(p.literal(c), 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// a group that does not capture leaves what it holds in its place
+		if c, ok := n.(*Concat); ok {
+			subs = append(subs, c.Subs...)
+		} else if n != nil {
+			subs = append(subs, n)
+		}
+		p.pos++
+	}
+	return subs, nil
+}
+
+// literal returns the node for the character c
+func (p *parser) literal(c rune) *Literal {
+	fold := p.flags.caseless && SimpleFold(c, p.opts.UTF8) != c
+	return &Literal{Runes: []rune{c}, Fold: fold}
+}
+
+// class returns the node for a character in ranges, or not in them if
+// negated, folding case if need be before the negation so that (?i)[^k]
+// rejects K as well
+func (p *parser) class(ranges []Range, negated bool) *Class {
+	if p.flags.caseless {
+		ranges = Fold(ranges, p.opts.UTF8)
+	}
+	highest := rune(unicode.MaxRune)
+	if !p.opts.UTF8 {
+		highest = 0xff
+	}
+	c := &Class{Negated: negated}
+	for _, r := range normalized(ranges) {
+		if r.Lo <= highest {
+			c.Ranges = append(c.Ranges, Range{r.Lo, min(r.Hi, highest)})
+		}
+	}
+	// everything and nothing are always written the same way round
+	all := []Range{{0, highest}}
+	switch {
+	case negated && len(c.Ranges) == 0:
+		c.Ranges, c.Negated = all, false
+	case negated && slices.Equal(c.Ranges, all):
+		c.Ranges, c.Negated = nil, false
+	}
+	return c
+}
+
+// quantify reads any ? + * or {n,m} following the node that ends at pos,
+// whose contents weigh inner against the repeat limit, and returns the node
+// repeated. Quantifiers only follow characters, sets and groups; anywhere
+// else they are taken literally.
+func (p *parser) quantify(n Node, inner int) (Node, error) {
+	p.weight = max(p.weight, inner)
+	if p.pos+1 >= len(p.pattern) {
+		return n, nil
+	}
+	var lo, hi int
+	switch p.pattern[p.pos+1] {
+	case '?':
+		lo, hi = 0, 1
+	case '+':
+		lo, hi = 1, -1
+	case '*':
+		lo, hi = 0, -1
+	case '{':
+		var end int
+		var ok bool
+		if lo, hi, end, ok = parseRepeat(p.pattern, p.pos+1); !ok {
+			return n, nil
+		}
+		expr := p.pattern[p.pos+1 : end+1]
+		if hi >= 0 && lo > hi {
+			return nil, &Error{Code: ErrInvalidRepeatSize, Expr: expr, Offset: p.pos + 1}
+		}
+		count := hi
+		if count < 0 {
+			count = lo
+		}
+		if count > p.opts.MaxRepeat || inner*count > p.opts.MaxRepeat {
+			return nil, &Error{Code: ErrRepeatTooLarge, Expr: expr, Offset: p.pos + 1}
+		}
+		p.weight = max(p.weight, inner*count)
+		p.pos = end - 1
+	default:
+		return n, nil
+	}
+	p.pos++
+	// a ? after the quantifier makes it lazy
+	lazy := p.pos+1 < len(p.pattern) && p.pattern[p.pos+1] == '?'
+	if lazy {
+		p.pos++
+	}
+	return &Repeat{Sub: n, Min: lo, Max: hi, Lazy: lazy}, nil
+}
+
+// parseParen reads a group or lookaround from the ( at pos, leaving pos on
+// the ) or quantifier that ends it. Flags on their own, as in (?i), return a
+// nil node and apply until the end of the group they are in.
+func (p *parser) parseParen() (Node, error) {
+	open := p.pos
+	p.pos++ // move past (
+	name := ""
+	capture, inner := true, p.flags
+	rest := p.pattern[p.pos:]
+	if kind, ok := lookaroundKind(rest); ok {
+		p.pos += len(kind)
+		return p.parseLookaround(open, kind[1] == '<', kind[len(kind)-1] == '!')
+	}
+	if strings.HasPrefix(rest, "?P<") || strings.HasPrefix(rest, "?<") {
+		var ok bool
+		name, p.pos, ok = parseName(p.pattern, strings.IndexByte(rest, '<')+p.pos+1)
+		if !ok {
+			return nil, &Error{Code: ErrInvalidGroupName, Expr: p.pattern[open:], Offset: open}
+		}
+		if slices.Contains(p.names, name) {
+			return nil, &Error{Code: ErrDuplicateName, Expr: p.pattern[open:p.pos], Offset: open}
+		}
+	} else if strings.HasPrefix(rest, "?") {
+		var ok bool
+		inner, p.pos, ok = readFlags(p.pattern, p.pos+1, p.flags)
+		if !ok {
+			return nil, &Error{Code: ErrInvalidPerlOp, Expr: p.pattern[open:min(p.pos+1, len(p.pattern))], Offset: open}
+		}
+		if p.pattern[p.pos] == ')' {
+			p.flags = inner
+			return nil, nil
+		}
+		p.pos++ // move past :
+		capture = false
+	}
+	n, weight, err := p.parseGroup(open, name, capture, inner)
+	if err != nil {
+		return nil, err
+	}
+	return p.quantify(n, weight)
+}
+
+// parseLookaround reads the body of a lookaround opened at open, with pos
+// just past the (?= (?! (?<= or (?<!
+func (p *parser) parseLookaround(open int, behind bool, negated bool) (Node, error) {
+	sub, weight, err := p.parseGroup(open, "", false, p.flags)
+	if err != nil {
+		return nil, err
+	}
+	if _, most := Width(sub); behind && most < 0 {
+		return nil, &Error{Code: ErrInvalidLookbehind, Expr: p.pattern[open : p.pos+1], Offset: open}
+	}
+	return p.quantify(&Lookaround{Sub: sub, Behind: behind, Negated: negated}, weight)
+}
+
+// parseGroup reads the alternatives of a group opened at open, with pos just
+// past the ( and any name or flags, leaving pos on the closing ). inner are
+// the flags in force inside the group, which go back to what they were
+// outside once it closes. It also returns the weight of the contents.
+func (p *parser) parseGroup(open int, name string, capture bool, inner flags) (Node, int, error) {
+	if capture {
+		p.names = append(p.names, name)
+	}
+	index := len(p.names)
+	outerWeight, outerFlags := p.weight, p.flags
+	p.weight, p.flags = 1, inner
+	defer func() { p.flags = outerFlags }()
+
+	alternatives := []Node{}
+	for {
+		subs, err := p.parseConcat(true)
+		if err != nil {
+			return nil, 0, err
+		}
+		if p.pos >= len(p.pattern) {
+			return nil, 0, &Error{Code: ErrMissingParen, Expr: p.pattern[open:], Offset: open}
+		}
+		alternatives = append(alternatives, concat(subs))
+		if p.pattern[p.pos] == ')' {
+			break
+		}
+		p.pos++ // move past |
+	}
+	weight := p.weight
+	p.weight = outerWeight
+	n := alternate(alternatives)
+	if capture {
+		n = &Group{Sub: n, Index: index, Name: name}
+	}
+	return n, weight, nil
+}
+
+// parseEscape reads the escape whose backslash is at pos, leaving pos on the
+// last byte of it
+func (p *parser) parseEscape() (Node, error) {
+	p.pos++
+	if p.pos >= len(p.pattern) {
+		return nil, &Error{Code: ErrTrailingBackslash, Expr: `\`, Offset: p.pos - 1}
+	}
+	switch c := p.pattern[p.pos]; c {
+	case '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		index := int(c - '0')
+		if index > len(p.names) {
+			return nil, &Error{Code: ErrInvalidBackref, Expr: p.pattern[p.pos-1 : p.pos+1], Offset: p.pos - 1}
+		}
+		return &Backref{Index: index, Fold: p.flags.caseless}, nil
+	case 'p', 'P':
+		ranges, negated, end, err := lookupProperty(p.pattern, p.pos)
+		if err != nil {
+			return nil, err
+		}
+		p.pos = end
+		return p.quantify(p.class(ranges, negated), 1)
+	case 'A':
+		return &Assertion{Kind: TextStart}, nil
+	case 'z':
+		return &Assertion{Kind: TextEnd}, nil
+	case 'Z':
+		return &Assertion{Kind: TextEndNewline}, nil
+	case 'b':
+		return &Assertion{Kind: WordBoundary}, nil
+	case 'B':
+		return &Assertion{Kind: NotWordBoundary}, nil
+	case 'k':
+		// \k<name> refers back to a named group
+		name, end, ok := "", p.pos, false
+		if p.pos+1 < len(p.pattern) && p.pattern[p.pos+1] == '<' {
+			name, end, ok = parseName(p.pattern, p.pos+2)
+		}
+		index := slices.Index(p.names, name)
+		if !ok || index < 0 {
+			return nil, &Error{Code: ErrInvalidBackref, Expr: p.pattern[p.pos-1 : max(end, p.pos+1)], Offset: p.pos - 1}
+		}
+		p.pos = end - 1
+		return &Backref{Index: index + 1, Name: name, Fold: p.flags.caseless}, nil
+	}
+	if class, negated, ok := lookupPerlClass(p.pattern[p.pos], p.opts.UTF8); ok {
+		return p.quantify(p.class(class.normalized(), negated), 1)
+	}
+	c, size, err := escapeChar(p.pattern, p.pos, p.opts.UTF8)
+	if err != nil {
+		return nil, err
+	}
+	p.pos += size - 1
+	return p.quantify(p.literal(c), 1)
+}
+
+// parseSet reads a [abcd] set from the [ at pos, leaving pos on the ]
+func (p *parser) parseSet() (Node, error) {
+	pattern := p.pattern
+	start := p.pos
+	p.pos++
+	negated := false
+	if p.pos < len(pattern) && pattern[p.pos] == '^' {
+		p.pos++
+		negated = true
+	}
+	missing := &Error{Code: ErrMissingBracket, Expr: pattern[start:], Offset: start}
+
+	// reads one member of the set, either a single character or a class such
+	// as \d or [:alpha:], leaving pos on the last byte of it
+	member := func() (c rune, class *charClass, err error) {
+		c, size, err := patternChar(pattern, p.pos, p.opts.UTF8)
+		if err != nil {
+			return 0, nil, err
+		}
+		if c == '[' && strings.HasPrefix(pattern[p.pos:], "[:") {
+			end := strings.Index(pattern[p.pos+2:], ":]")
+			if end >= 0 {
+				expr := pattern[p.pos : p.pos+2+end+2]
+				class, ok := posixClasses[expr[2:len(expr)-2]]
+				if !ok {
+					return 0, nil, &Error{Code: ErrInvalidCharClass, Expr: expr, Offset: p.pos}
+				}
+				p.pos += len(expr) - 1
+				return 0, &class, nil
+			}
+		}
+		if c != '\\' {
+			p.pos += size - 1
+			return c, nil, nil
+		}
+		p.pos++
+		if p.pos >= len(pattern) {
+			return 0, nil, missing
+		}
+		if pattern[p.pos] == 'p' || pattern[p.pos] == 'P' {
+			ranges, negated, end, err := lookupProperty(pattern, p.pos)
+			if err != nil {
+				return 0, nil, err
+			}
+			class := charClass{ranges: ranges}
+			if negated {
+				class = class.negate()
+			}
+			p.pos = end
+			return 0, &class, nil
+		}
+		if class, negated, ok := lookupPerlClass(pattern[p.pos], p.opts.UTF8); ok {
+			if negated {
+				class = class.negate()
+			}
+			return 0, &class, nil
+		}
+		c, size, err = escapeChar(pattern, p.pos, p.opts.UTF8)
+		if err != nil {
+			return 0, nil, err
+		}
+		p.pos += size - 1
+		return c, nil, nil
+	}
+
+	set := charClass{}
+	// a ] straight after the [ or [^ is a literal rather than the end
+	first := true
+	for ; p.pos < len(pattern); p.pos++ {
+		if pattern[p.pos] == ']' && !first {
+			return p.class(set.normalized(), negated), nil
+		}
+		first = false
+
+		lo := p.pos
+		c, class, err := member()
+		if err != nil {
+			return nil, err
+		}
+		if class != nil {
+			set.chars += class.chars
+			set.ranges = append(set.ranges, class.ranges...)
+			continue
+		}
+		// a - makes a range unless it is the last thing in the set
+		if p.pos+2 >= len(pattern) || pattern[p.pos+1] != '-' || pattern[p.pos+2] == ']' {
+			set.chars += string(c)
+			continue
+		}
+		p.pos += 2
+		hi, class, err := member()
+		if err != nil {
+			return nil, err
+		}
+		if class != nil || hi < c {
+			return nil, &Error{Code: ErrInvalidCharRange, Expr: pattern[lo : p.pos+1], Offset: lo}
+		}
+		set.ranges = append(set.ranges, Range{c, hi})
+	}
+	return nil, missing
+}
+
+// patternChar decodes the character of the pattern at rdx, returning its
+// length in bytes. Outside UTF-8 mode every byte is a character, taken as
+// the rune with the same value.
+func patternChar(pattern string, rdx int, utf8Mode bool) (rune, int, error) {
+	if !utf8Mode || pattern[rdx] < utf8.RuneSelf {
+		return rune(pattern[rdx]), 1, nil
+	}
+	c, size := utf8.DecodeRuneInString(pattern[rdx:])
+	if c == utf8.RuneError && size == 1 {
+		return 0, 0, &Error{Code: ErrInvalidUTF8, Expr: pattern[rdx : rdx+1], Offset: rdx}
+	}
+	return c, size, nil
+}
+
+// parseName reads a group name closed by '>' starting at rdx, returning the
+// name and the offset just past the '>'
+func parseName(pattern string, rdx int) (string, int, bool) {
+	end := strings.IndexByte(pattern[rdx:], '>')
+	if end <= 0 {
+		return "", rdx, false
+	}
+	name := pattern[rdx : rdx+end]
+	for i := 0; i < len(name); i++ {
+		if !isWordByte(name[i]) {
+			return "", rdx, false
+		}
+	}
+	return name, rdx + end + 1, true
+}
+
+// parseRepeat reads a {n}, {n,} or {n,m} count from the { at rdx, returning
+// the bounds (max -1 when there is no upper bound) and the offset of the }.
+// ok is false when the text is not a count at all, leaving the { a literal.
+func parseRepeat(pattern string, rdx int) (lo int, hi int, end int, ok bool) {
+	// numbers are clamped well past any sensible limit instead of overflowing
+	const tooBig = 1 << 30
+	number := func() (int, bool) {
+		start := rdx
+		n := 0
+		for rdx < len(pattern) && pattern[rdx] >= '0' && pattern[rdx] <= '9' {
+			n = min(n*10+int(pattern[rdx]-'0'), tooBig)
+			rdx++
+		}
+		return n, rdx > start
+	}
+
+	rdx++ // move past {
+	lo, ok = number()
+	if !ok || rdx >= len(pattern) {
+		return 0, 0, 0, false
+	}
+	hi = lo
+	if pattern[rdx] == ',' {
+		rdx++
+		var bounded bool
+		if hi, bounded = number(); !bounded {
+			hi = -1
+		}
+	}
+	if rdx >= len(pattern) || pattern[rdx] != '}' {
+		return 0, 0, 0, false
+	}
+	return lo, hi, rdx, true
+}
+
+// lookaroundKind finds the ?= ?! ?<= or ?<! that rest starts with, if any
+func lookaroundKind(rest string) (string, bool) {
+	for _, kind := range []string{"?=", "?!", "?<=", "?<!"} {
+		if strings.HasPrefix(rest, kind) {
+			return kind, true
+		}
+	}
+	return "", false
+}
+
+// readFlags reads the flags of a (?i) or (?i:...) group from rdx, just past
+// the ?, applying them to f. It returns the offset of the closing ) or :.
+// A group such as (?:...) can set no flags at all and only groups.
+func readFlags(pattern string, rdx int, f flags) (flags, int, bool) {
+	on := true
+	start := rdx
+	for ; rdx < len(pattern); rdx++ {
+		switch pattern[rdx] {
+		case 'i':
+			f.caseless = on
+		case 'm':
+			f.multiline = on
+		case 's':
+			f.dotNewline = on
+		case '-':
+			if !on || rdx+1 >= len(pattern) || pattern[rdx+1] == ')' || pattern[rdx+1] == ':' {
+				return f, rdx, false
+			}
+			on = false
+		case ')', ':':
+			return f, rdx, rdx > start || pattern[rdx] == ':'
+		default:
+			return f, rdx, false
+		}
+	}
+	return f, rdx, false
+}
+
+///////////////////////////////////////////////////////////
+// Classes of characters, escapes and case folding
+
+// charClass is a named group of characters such as \d or [:alpha:]
+type charClass struct {
+	chars  string
+	ranges []Range
+}
+
+// the POSIX bracket expressions, as defined for the C locale
+var posixClasses = map[string]charClass{
+	"alpha":  {ranges: []Range{{'A', 'Z'}, {'a', 'z'}}},
+	"digit":  {ranges: []Range{{'0', '9'}}},
+	"alnum":  {ranges: []Range{{'0', '9'}, {'A', 'Z'}, {'a', 'z'}}},
+	"upper":  {ranges: []Range{{'A', 'Z'}}},
+	"lower":  {ranges: []Range{{'a', 'z'}}},
+	"space":  {chars: spaceChars},
+	"blank":  {chars: " \t"},
+	"punct":  {ranges: []Range{{'!', '/'}, {':', '@'}, {'[', '`'}, {'{', '~'}}},
+	"xdigit": {ranges: []Range{{'0', '9'}, {'A', 'F'}, {'a', 'f'}}},
+	"print":  {ranges: []Range{{' ', '~'}}},
+	"graph":  {ranges: []Range{{'!', '~'}}},
+	"cntrl":  {ranges: []Range{{0, 0x1f}, {0x7f, 0x7f}}},
+}
+
+// perlClasses are the shorthand escapes such as \d, whose upper case forms
+// (\D and so on) match every character the lower case one does not
+var perlClasses = map[byte]charClass{
+	'd': {chars: digits},
+	'w': {chars: wordChars},
+	's': {chars: spaceChars},
+	// horizontal and vertical whitespace, as Perl defines them
+	'h': {chars: " \t", ranges: []Range{{0xa0, 0xa0}, {0x1680, 0x1680}, {0x180e, 0x180e}, {0x2000, 0x200a}, {0x202f, 0x202f}, {0x205f, 0x205f}, {0x3000, 0x3000}}},
+	'v': {chars: "\n\v\f\r", ranges: []Range{{0x85, 0x85}, {0x2028, 0x2029}}},
+}
+
+// unicodeWord is what \w means in UTF-8 mode: letters, marks, digits and
+// connecting punctuation such as _
+var unicodeWord = charClass{ranges: tableRanges(unicode.L, unicode.M, unicode.Nd, unicode.Pc)}
+
+// tableRanges returns every character in the tables as normalized ranges
+func tableRanges(tables ...*unicode.RangeTable) []Range {
+	class := charClass{}
+	// a stride picks out every nth character, so only a stride of one is a
+	// range we can use as it stands
+	add := func(lo, hi, stride rune) {
+		if stride == 1 {
+			class.ranges = append(class.ranges, Range{lo, hi})
+			return
+		}
+		for c := lo; c <= hi; c += stride {
+			class.ranges = append(class.ranges, Range{c, c})
+		}
+	}
+	for _, table := range tables {
+		for _, r := range table.R16 {
+			add(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+		}
+		for _, r := range table.R32 {
+			add(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+		}
+	}
+	return class.normalized()
+}
+
+// lookupPerlClass finds the class for an escape such as \d or \S, reporting
+// whether it is one of the negated upper case forms
+func lookupPerlClass(c byte, utf8Mode bool) (class charClass, negated bool, ok bool) {
+	negated = c >= 'A' && c <= 'Z'
+	if negated {
+		c += 'a' - 'A'
+	}
+	if c == 'w' && utf8Mode {
+		return unicodeWord, negated, true
+	}
+	class, ok = perlClasses[c]
+	return class, negated, ok
+}
+
+// lookupProperty reads a Unicode property class such as \pL, \p{Greek} or
+// \P{Lu} from the p or P at rdx, returning the offset of its last byte. The
+// name is a general category or script from the unicode package, or Any,
+// and is negated by \P or a leading ^ as in \p{^Greek}.
+func lookupProperty(pattern string, rdx int) (ranges []Range, negated bool, end int, err error) {
+	start := rdx - 1
+	negated = pattern[rdx] == 'P'
+	rdx++
+	if rdx >= len(pattern) {
+		return nil, false, 0, &Error{Code: ErrInvalidCharClass, Expr: pattern[start:], Offset: start}
+	}
+	name := pattern[rdx : rdx+1]
+	end = rdx
+	if pattern[rdx] == '{' {
+		brace := strings.IndexByte(pattern[rdx:], '}')
+		if brace < 0 {
+			return nil, false, 0, &Error{Code: ErrInvalidCharClass, Expr: pattern[start:], Offset: start}
+		}
+		end = rdx + brace
+		name = pattern[rdx+1 : end]
+		if strings.HasPrefix(name, "^") {
+			negated = !negated
+			name = name[1:]
+		}
+	}
+	if name == "Any" {
+		return []Range{{0, unicode.MaxRune}}, negated, end, nil
+	}
+	table, ok := unicode.Categories[name]
+	if !ok {
+		table, ok = unicode.Scripts[name]
+	}
+	if !ok {
+		return nil, false, 0, &Error{Code: ErrInvalidCharClass, Expr: pattern[start : end+1], Offset: start}
+	}
+	return tableRanges(table), negated, end, nil
+}
+
+// the escapes that stand for a single control character
+var controlEscapes = map[byte]byte{
+	't': '\t',
+	'n': '\n',
+	'r': '\r',
+	'f': '\f',
+	'a': '\a',
+	'e': 0x1b,
+}
+
+// escapeLiteral returns the character an escape such as \n or \. stands
+// for. Any punctuation can be escaped, but an escaped letter or digit that
+// means nothing is refused rather than quietly taken as a literal.
+func escapeLiteral(c byte) (byte, bool) {
+	if lit, ok := controlEscapes[c]; ok {
+		return lit, true
+	}
+	if isWordByte(c) {
+		return 0, false
+	}
+	return c, true
+}
+
+// escapeChar is escapeLiteral for the escaped character at rdx, just past
+// the backslash, also returning its length. Anything outside ASCII stands
+// for itself.
+func escapeChar(pattern string, rdx int, utf8Mode bool) (rune, int, error) {
+	c, size, err := patternChar(pattern, rdx, utf8Mode)
+	if err != nil {
+		return 0, 0, err
+	}
+	if c == 'x' {
+		return hexEscape(pattern, rdx, utf8Mode)
+	}
+	if c < utf8.RuneSelf {
+		lit, ok := escapeLiteral(byte(c))
+		if !ok {
+			return 0, 0, &Error{Code: ErrInvalidEscape, Expr: pattern[rdx-1 : rdx+1], Offset: rdx - 1}
+		}
+		c = rune(lit)
+	}
+	return c, size, nil
+}
+
+// hexEscape reads a character given by its code, as in \x41 or \x{1F600},
+// from the x at rdx, returning it and the length of the escape from there.
+// Outside UTF-8 mode the code is that of a byte.
+func hexEscape(pattern string, rdx int, utf8Mode bool) (rune, int, error) {
+	digits, size := "", 1
+	if strings.HasPrefix(pattern[rdx+1:], "{") {
+		if end := strings.IndexByte(pattern[rdx:], '}'); end > 0 {
+			digits, size = pattern[rdx+2:rdx+end], end+1
+		}
+	} else if rdx+3 <= len(pattern) {
+		digits, size = pattern[rdx+1:rdx+3], 3
+	}
+	code, err := strconv.ParseUint(digits, 16, 32)
+	c := rune(code)
+	if err != nil || utf8Mode && !utf8.ValidRune(c) || !utf8Mode && c > 0xff {
+		return 0, 0, &Error{Code: ErrInvalidEscape, Expr: pattern[rdx-1 : rdx+size], Offset: rdx - 1}
+	}
+	return c, size, nil
+}
+
+// normalized returns the characters in the class as sorted ranges that
+// neither overlap nor touch
+func (class charClass) normalized() []Range {
+	ranges := slices.Clone(class.ranges)
+	for _, c := range class.chars {
+		ranges = append(ranges, Range{c, c})
+	}
+	return normalized(ranges)
+}
+
+// normalized sorts ranges and merges those that overlap or touch, returning
+// nil for no ranges at all
+func normalized(ranges []Range) []Range {
+	ranges = slices.Clone(ranges)
+	slices.SortFunc(ranges, func(a, b Range) int {
+		return int(a.Lo - b.Lo)
+	})
+	var merged []Range
+	for _, r := range ranges {
+		if last := len(merged) - 1; last >= 0 && r.Lo <= merged[last].Hi+1 {
+			merged[last].Hi = max(merged[last].Hi, r.Hi)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// negate returns a class holding every character that is not in this one
+func (class charClass) negate() charClass {
+	negated := charClass{}
+	next := rune(0)
+	for _, r := range class.normalized() {
+		if r.Lo > next {
+			negated.ranges = append(negated.ranges, Range{next, r.Lo - 1})
+		}
+		next = r.Hi + 1
+	}
+	if next <= unicode.MaxRune {
+		negated.ranges = append(negated.ranges, Range{next, unicode.MaxRune})
+	}
+	return negated
+}
+
+// foldBounds are the lowest and highest characters with other cases
+var foldBounds = Range{
+	Lo: rune(unicode.CaseRanges[0].Lo),
+	Hi: rune(unicode.CaseRanges[len(unicode.CaseRanges)-1].Hi),
+}
+
+// SimpleFold returns the next character in the case folding orbit of c,
+// which is c itself when it has no other cases. Outside UTF-8 mode only
+// ASCII letters have cases, since other bytes need not be text.
+func SimpleFold(c rune, utf8Mode bool) rune {
+	if utf8Mode {
+		return unicode.SimpleFold(c)
+	}
+	switch {
+	case c >= 'A' && c <= 'Z':
+		return c + 'a' - 'A'
+	case c >= 'a' && c <= 'z':
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+// EqualFold reports whether a and b are the same character ignoring case
+func EqualFold(a, b rune, utf8Mode bool) bool {
+	for c := a; ; {
+		if c == b {
+			return true
+		}
+		if c = SimpleFold(c, utf8Mode); c == a {
+			return false
+		}
+	}
+}
+
+// Fold returns ranges normalized with every other case of their characters
+// added
+func Fold(ranges []Range, utf8Mode bool) []Range {
+	ranges = normalized(ranges)
+	folded := slices.Clone(ranges)
+	for _, r := range ranges {
+		for c := max(r.Lo, foldBounds.Lo); c <= min(r.Hi, foldBounds.Hi); c++ {
+			for f := SimpleFold(c, utf8Mode); f != c; f = SimpleFold(f, utf8Mode) {
+				folded = append(folded, Range{f, f})
+			}
+		}
+	}
+	return normalized(folded)
+}
+
+// IsWordChar uses the same definition of a word as \w
+func IsWordChar(c rune, utf8Mode bool) bool {
+	if c < utf8.RuneSelf {
+		return isWordByte(byte(c))
+	}
+	return utf8Mode && InRanges(unicodeWord.ranges, c)
+}
+
+// isWordByte uses the same definition of a word as \w for ASCII
+func isWordByte(c byte) bool {
+	return strings.IndexByte(wordChars, c) >= 0
+}
+
+// InRanges reports whether c falls in one of ranges, which are sorted and do
+// not overlap
+func InRanges(ranges []Range, c rune) bool {
+	_, found := slices.BinarySearchFunc(ranges, c, func(r Range, c rune) int {
+		switch {
+		case r.Hi < c:
+			return -1
+		case r.Lo > c:
+			return 1
+		}
+		return 0
+	})
+	return found
+}
+
+const (
+	digits     = "0123456789"
+	alpha      = "abcdefghijklmnopqrstuvwxyz"
+	wordChars  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ" + alpha + digits + "_"
+	spaceChars = " \t\n\r\f\v"
+)
@@ -0,0 +1,236 @@
+package syntax
+
+import (
+	"slices"
+)
+
+///////////////////////////////////////////////////////////
+// Rewriting trees into simpler ones that match the same way
+
+// Simplify returns a tree that matches exactly what n does, with the same
+// leftmost match and captures, but is quicker to run. It leaves n as it is.
+//
+//   - literals next to each other are joined into one: a(?:b)c is abc
+//   - a literal prefix shared by alternatives next to each other is taken
+//     out of them: abc|abd is ab(?:c|d)
+//   - alternatives next to each other that are each a single character
+//     become a set: c|d is [cd]
+//   - a repeat of a repeat becomes one repeat: (?:a*)* is a*, and (?:a+)?
+//     is a* too
+//   - a repeat of exactly once goes: x{1} is x
+//
+// Repeats of repeats are where backtracking blows up, since there are so
+// many ways to split a run between the passes of the two, so taking them out
+// narrows what a pattern can be made to do on a hostile line.
+func Simplify(n Node) Node {
+	switch n := n.(type) {
+	case *Concat:
+		subs := []Node{}
+		for _, sub := range n.Subs {
+			sub = Simplify(sub)
+			if c, ok := sub.(*Concat); ok {
+				subs = append(subs, c.Subs...)
+				continue
+			}
+			subs = append(subs, sub)
+		}
+		return concat(joinLiterals(subs))
+
+	case *Alternate:
+		subs := []Node{}
+		for _, sub := range n.Subs {
+			sub = Simplify(sub)
+			if a, ok := sub.(*Alternate); ok {
+				subs = append(subs, a.Subs...)
+				continue
+			}
+			subs = append(subs, sub)
+		}
+		return alternate(joinChars(factor(subs)))
+
+	case *Repeat:
+		sub := Simplify(n.Sub)
+		if n.Min == 1 && n.Max == 1 {
+			return sub
+		}
+		if inner, ok := sub.(*Repeat); ok && inner.Lazy == n.Lazy && isPlain(n) && isPlain(inner) {
+			if inner.Min == n.Min && inner.Max == n.Max {
+				return inner
+			}
+			// any other mix of *, + and ? can match any number of times,
+			// none of them included
+			return &Repeat{Sub: inner.Sub, Min: 0, Max: -1, Lazy: n.Lazy}
+		}
+		return &Repeat{Sub: sub, Min: n.Min, Max: n.Max, Lazy: n.Lazy}
+
+	case *Group:
+		return &Group{Sub: Simplify(n.Sub), Index: n.Index, Name: n.Name}
+
+	case *Lookaround:
+		return &Lookaround{Sub: Simplify(n.Sub), Behind: n.Behind, Negated: n.Negated}
+	}
+	return n
+}
+
+// isPlain reports whether r is a *, + or ?
+func isPlain(r *Repeat) bool {
+	return r.Min <= 1 && r.Max < 0 || r.Min == 0 && r.Max == 1
+}
+
+// joinLiterals joins each run of literals in subs that fold the same way
+// into one literal
+func joinLiterals(subs []Node) []Node {
+	joined := []Node{}
+	for _, sub := range subs {
+		lit, ok := sub.(*Literal)
+		if !ok || len(joined) == 0 {
+			joined = append(joined, sub)
+			continue
+		}
+		last, ok := joined[len(joined)-1].(*Literal)
+		if !ok || last.Fold != lit.Fold {
+			joined = append(joined, sub)
+			continue
+		}
+		runes := append(slices.Clone(last.Runes), lit.Runes...)
+		joined[len(joined)-1] = &Literal{Runes: runes, Fold: lit.Fold}
+	}
+	return joined
+}
+
+// factor takes the literal prefix out of each run of alternatives next to
+// each other that share one. Only the alternatives next to each other can
+// be joined, as the order they are tried in has to stay the same.
+func factor(subs []Node) []Node {
+	factored := []Node{}
+	for i := 0; i < len(subs); {
+		prefix := leadingLiteral(subs[i])
+		common := 0
+		if prefix != nil {
+			common = len(prefix.Runes)
+		}
+		j := i + 1
+		for ; j < len(subs) && common > 0; j++ {
+			next := leadingLiteral(subs[j])
+			if next == nil || next.Fold != prefix.Fold {
+				break
+			}
+			n := 0
+			for n < common && n < len(next.Runes) && next.Runes[n] == prefix.Runes[n] {
+				n++
+			}
+			if n == 0 {
+				break
+			}
+			common = n
+		}
+		// an alternative that is nothing but the prefix ends the run, since
+		// once the prefix has matched it matches whatever follows, and only
+		// the alternatives before it come ahead of that
+		for k := i; k < j-1; k++ {
+			if trim(subs[k], common) == nil {
+				j = k + 1
+			}
+		}
+		if j-i < 2 {
+			factored = append(factored, subs[i])
+			i++
+			continue
+		}
+
+		rests := []Node{}
+		optional := false
+		for _, sub := range subs[i:j] {
+			if rest := trim(sub, common); rest != nil {
+				rests = append(rests, rest)
+			} else {
+				optional = true
+			}
+		}
+		rest := alternate(rests)
+		if optional {
+			rest = &Repeat{Sub: rest, Min: 0, Max: 1}
+		}
+		head := &Literal{Runes: prefix.Runes[:common], Fold: prefix.Fold}
+		factored = append(factored, Simplify(&Concat{Subs: []Node{head, rest}}))
+		i = j
+	}
+	return factored
+}
+
+// leadingLiteral returns the literal n starts with, if it starts with one
+func leadingLiteral(n Node) *Literal {
+	switch n := n.(type) {
+	case *Literal:
+		return n
+	case *Concat:
+		if len(n.Subs) == 0 {
+			return nil
+		}
+		if lit, ok := n.Subs[0].(*Literal); ok {
+			return lit
+		}
+	}
+	return nil
+}
+
+// trim returns n without the first count characters of its leading literal,
+// or nil if that leaves nothing
+func trim(n Node, count int) Node {
+	var lit *Literal
+	var after []Node
+	switch n := n.(type) {
+	case *Literal:
+		lit = n
+	case *Concat:
+		lit, after = n.Subs[0].(*Literal), n.Subs[1:]
+	}
+	subs := []Node{}
+	if count < len(lit.Runes) {
+		subs = append(subs, &Literal{Runes: lit.Runes[count:], Fold: lit.Fold})
+	}
+	subs = append(subs, after...)
+	if len(subs) == 0 {
+		return nil
+	}
+	return concat(subs)
+}
+
+// joinChars turns each run of alternatives next to each other that each
+// match a single character into one class. Whichever of them matches uses
+// up the same one character, so the order they are tried in does not
+// matter.
+func joinChars(subs []Node) []Node {
+	joined := []Node{}
+	var ranges []Range
+	run := 0
+	flush := func(i int) {
+		switch {
+		case run == 1:
+			joined = append(joined, subs[i-1])
+		case run > 1:
+			joined = append(joined, &Class{Ranges: normalized(ranges)})
+		}
+		ranges, run = nil, 0
+	}
+	for i, sub := range subs {
+		switch sub := sub.(type) {
+		case *Literal:
+			if len(sub.Runes) == 1 && !sub.Fold {
+				ranges = append(ranges, Range{sub.Runes[0], sub.Runes[0]})
+				run++
+				continue
+			}
+		case *Class:
+			if !sub.Negated {
+				ranges = append(ranges, sub.Ranges...)
+				run++
+				continue
+			}
+		}
+		flush(i)
+		joined = append(joined, sub)
+	}
+	flush(len(subs))
+	return joined
+}
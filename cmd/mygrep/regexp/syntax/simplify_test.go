@@ -0,0 +1,132 @@
+package syntax
+
+import (
+	"reflect"
+	"testing"
+)
+
+var simplifyTests = []StringInput{
+	{
+		name:    "literals_joined",
+		pattern: "a(?:b)c",
+		want:    "abc",
+	},
+	{
+		name:    "prefix_factored",
+		pattern: "(?:abc|abd)",
+		want:    "ab[cd]",
+	},
+	{
+		name:    "prefix_factored_in_group",
+		pattern: "x(abc|abd|e)",
+		want:    "x(ab[cd]|e)",
+	},
+	{
+		name:    "prefix_of_longer_runs",
+		pattern: "(?:abcx|abcy|abz)",
+		want:    "ab(?:c[xy]|z)",
+	},
+	{
+		name:    "whole_prefix_last",
+		pattern: "(?:ab|a)",
+		want:    "ab?",
+	},
+	{
+		name:    "whole_prefix_first_kept",
+		pattern: "(?:a|ab)",
+		want:    "(?:a|ab)",
+	},
+	{
+		name:    "prefix_not_next_to_each_other",
+		pattern: "(?:ab|c|ad)",
+		want:    "(?:ab|c|ad)",
+	},
+	{
+		name:    "caseless_prefix_kept_apart",
+		pattern: "(?:(?i:ab)|abc)",
+		want:    "(?:(?i:ab)|abc)",
+	},
+	{
+		name:    "chars_to_class",
+		pattern: "(?:a|b|c)",
+		want:    "[a-c]",
+	},
+	{
+		name:    "chars_and_sets_to_class",
+		pattern: "(?:x|[0-9]|y|zz)",
+		want:    "(?:[0-9xy]|zz)",
+	},
+	{
+		name:    "negated_set_left",
+		pattern: "(?:a|[^b])",
+		want:    "(?:a|[^b])",
+	},
+	{
+		name:    "nested_star",
+		pattern: "(?:a*)*",
+		want:    "a*",
+	},
+	{
+		name:    "star_of_plus",
+		pattern: "(?:a+)*",
+		want:    "a*",
+	},
+	{
+		name:    "optional_plus",
+		pattern: "(?:a+)?",
+		want:    "a*",
+	},
+	{
+		name:    "nested_plus",
+		pattern: "(?:a+)+",
+		want:    "a+",
+	},
+	{
+		name:    "lazy_mix_kept",
+		pattern: "(?:a*?)*",
+		want:    "(?:a*?)*",
+	},
+	{
+		name:    "counted_kept",
+		pattern: "(?:a{2})*",
+		want:    "(?:a{2})*",
+	},
+	{
+		name:    "captured_repeat_kept",
+		pattern: "(a*)*",
+		want:    "(a*)*",
+	},
+	{
+		name:    "once",
+		pattern: "x{1}y{1,1}?",
+		want:    "xy",
+	},
+	{
+		name:    "in_lookaround",
+		pattern: "(?=(?:ab|ac))",
+		want:    "(?=a[bc])",
+	},
+}
+
+func TestSimplify(t *testing.T) {
+	for _, tt := range simplifyTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := Parse(tt.pattern, tt.opts)
+			if err != nil {
+				t.Fatalf("Parse(%q) = %v", tt.pattern, err)
+			}
+			printed := tree.String()
+			simple := Simplify(tree)
+			if got := simple.String(); got != tt.want {
+				t.Errorf("Simplify(%q) = %q; want %q", tt.pattern, got, tt.want)
+			}
+			if got := tree.String(); got != printed {
+				t.Errorf("Simplify(%q) changed the tree it was given to %q", tt.pattern, got)
+			}
+			// simplifying what comes out again changes nothing
+			if again := Simplify(simple); !reflect.DeepEqual(again, simple) {
+				t.Errorf("Simplify(%q) = %s; want %s", simple, again, simple)
+			}
+		})
+	}
+}
@@ -0,0 +1,431 @@
+// Package syntax parses regular expressions into a tree of typed nodes,
+// which the regexp package compiles into the graph it matches with, and
+// prints that tree back out as a pattern.
+//
+// The printed form is canonical: whatever was written, a tree prints the
+// same way, spelling out flags, classes and anything that is not plain
+// printable ASCII so that it means the same thing in UTF-8 and byte mode.
+// Parsing what String returns gives back an equal tree.
+package syntax
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+///////////////////////////////////////////////////////////
+// Errors reported when a pattern cannot be parsed
+
+// ErrorCode describes the kind of problem found in a pattern
+type ErrorCode string
+
+const (
+	ErrEmptyPattern      ErrorCode = "pattern must contain at least one character"
+	ErrMissingBracket    ErrorCode = "missing closing ]"
+	ErrMissingParen      ErrorCode = "missing closing )"
+	ErrTrailingBackslash ErrorCode = "trailing backslash at end of expression"
+	ErrInvalidBackref    ErrorCode = "backreference to undefined group"
+	ErrInvalidPerlOp     ErrorCode = "invalid or unsupported Perl syntax"
+	ErrInvalidGroupName  ErrorCode = "invalid capture group name"
+	ErrDuplicateName     ErrorCode = "duplicate capture group name"
+	ErrInvalidRepeatSize ErrorCode = "invalid repeat count"
+	ErrRepeatTooLarge    ErrorCode = "repeat count exceeds limit"
+	ErrInvalidCharRange  ErrorCode = "invalid character class range"
+	ErrInvalidCharClass  ErrorCode = "invalid character class"
+	ErrInvalidEscape     ErrorCode = "invalid escape sequence"
+	ErrInvalidUTF8       ErrorCode = "invalid UTF-8"
+	ErrInvalidLookbehind ErrorCode = "lookbehind must have a bounded length"
+)
+
+func (code ErrorCode) String() string {
+	return string(code)
+}
+
+// Error reports what is wrong with a pattern and where
+type Error struct {
+	Code   ErrorCode
+	Expr   string // the offending construct
+	Offset int    // byte offset of Expr within the pattern
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("error parsing regexp at offset %d: %s: `%s`", e.Offset, e.Code, e.Expr)
+}
+
+///////////////////////////////////////////////////////////
+// The nodes of a parse tree
+
+// Node is a node of a parse tree. String prints it as a pattern.
+type Node interface {
+	fmt.Stringer
+	// write prints the node into b as a pattern
+	write(b *strings.Builder)
+}
+
+// Literal matches its characters one after the other
+type Literal struct {
+	Runes []rune
+	// Fold matches each character whatever its case, as (?i) does. It is
+	// only set on characters that have other cases.
+	Fold bool
+}
+
+// Class matches a single character in one of Ranges, or in none of them if
+// Negated. A class matching every character is never negated, nor is one
+// matching none.
+type Class struct {
+	Ranges  []Range // sorted, neither overlapping nor touching
+	Negated bool
+}
+
+// Range covers the characters from Lo to Hi inclusive
+type Range struct {
+	Lo rune
+	Hi rune
+}
+
+// Concat matches each of Subs one after the other. The empty Concat matches
+// the empty string, as an empty group or alternative does.
+type Concat struct {
+	Subs []Node
+}
+
+// Alternate matches the first of Subs that lets the rest of the pattern
+// match
+type Alternate struct {
+	Subs []Node
+}
+
+// Repeat matches Sub between Min and Max times (Max < 0 means no limit), as
+// many as possible unless Lazy
+type Repeat struct {
+	Sub  Node
+	Min  int
+	Max  int
+	Lazy bool
+}
+
+// Group is a capturing group. Groups that do not capture are left out of
+// the tree, leaving just what they hold.
+type Group struct {
+	Sub   Node
+	Index int    // numbered from 1 in the order the groups open
+	Name  string // "" for an unnamed group
+}
+
+// Assertion matches without using up any of the line, at the places its
+// Kind stands for
+type Assertion struct {
+	Kind AssertionKind
+}
+
+// AssertionKind says where an Assertion matches
+type AssertionKind uint8
+
+const (
+	TextStart       AssertionKind = iota // \A, and ^ outside multi-line mode
+	TextEnd                              // \z, and $ outside multi-line mode
+	TextEndNewline                       // \Z, which also allows one final newline
+	LineStart                            // ^ in multi-line mode
+	LineEnd                              // $ in multi-line mode
+	WordBoundary                         // \b
+	NotWordBoundary                      // \B
+)
+
+// Lookaround matches without using up any of the line when Sub matches at
+// that point, or when it does not if Negated. A lookbehind has Sub end at
+// that point rather than start there, and Sub has to be of bounded length.
+type Lookaround struct {
+	Sub     Node
+	Behind  bool
+	Negated bool
+}
+
+// Backref matches the text that group Index last captured
+type Backref struct {
+	Index int
+	Name  string // the group's name, if it was referred to by name
+	Fold  bool   // matches the text whatever its case
+}
+
+// checking interfaces are implemented fully
+var (
+	_ Node = &Literal{}
+	_ Node = &Class{}
+	_ Node = &Concat{}
+	_ Node = &Alternate{}
+	_ Node = &Repeat{}
+	_ Node = &Group{}
+	_ Node = &Assertion{}
+	_ Node = &Lookaround{}
+	_ Node = &Backref{}
+)
+
+// Width works out the fewest and most characters n can match, with most -1
+// when there is no limit
+func Width(n Node) (fewest int, most int) {
+	switch n := n.(type) {
+	case *Literal:
+		return len(n.Runes), len(n.Runes)
+	case *Class:
+		return 1, 1
+	case *Concat:
+		for _, sub := range n.Subs {
+			lo, hi := Width(sub)
+			fewest += lo
+			if hi < 0 || most < 0 {
+				most = -1
+			} else {
+				most += hi
+			}
+		}
+		return fewest, most
+	case *Alternate:
+		fewest = -1
+		for _, sub := range n.Subs {
+			lo, hi := Width(sub)
+			if fewest < 0 || lo < fewest {
+				fewest = lo
+			}
+			if hi < 0 || most < 0 {
+				most = -1
+			} else {
+				most = max(most, hi)
+			}
+		}
+		return fewest, most
+	case *Repeat:
+		lo, hi := Width(n.Sub)
+		switch {
+		case n.Max == 0:
+			hi = 0
+		case hi != 0 && n.Max < 0:
+			hi = -1
+		case hi > 0:
+			hi *= n.Max
+		}
+		return lo * n.Min, hi
+	case *Group:
+		return Width(n.Sub)
+	case *Assertion, *Lookaround:
+		return 0, 0
+	}
+	// a backreference could be any length at all
+	return 0, -1
+}
+
+///////////////////////////////////////////////////////////
+// Printing trees back out as patterns
+
+func (l *Literal) String() string    { return format(l) }
+func (c *Class) String() string      { return format(c) }
+func (c *Concat) String() string     { return format(c) }
+func (a *Alternate) String() string  { return format(&Concat{Subs: []Node{a}}) }
+func (r *Repeat) String() string     { return format(r) }
+func (g *Group) String() string      { return format(g) }
+func (a *Assertion) String() string  { return format(a) }
+func (l *Lookaround) String() string { return format(l) }
+func (br *Backref) String() string   { return format(br) }
+
+func format(n Node) string {
+	// an empty pattern is refused, but an empty group is not
+	if c, ok := n.(*Concat); ok && len(c.Subs) == 0 {
+		return "(?:)"
+	}
+	b := &strings.Builder{}
+	n.write(b)
+	return b.String()
+}
+
+func (l *Literal) write(b *strings.Builder) {
+	if l.Fold {
+		b.WriteString("(?i:")
+	}
+	for _, c := range l.Runes {
+		writeChar(b, c, false)
+	}
+	if l.Fold {
+		b.WriteString(")")
+	}
+}
+
+func (c *Class) write(b *strings.Builder) {
+	switch {
+	case len(c.Ranges) == 0:
+		// only a negated class can be written empty, so this one has to
+		// be spelt as matching nothing that there is
+		b.WriteString(`\P{Any}`)
+		return
+	case len(c.Ranges) == 1 && c.Ranges[0] == Range{0, unicode.MaxRune}:
+		b.WriteString("(?s:.)")
+		return
+	}
+	b.WriteString("[")
+	if c.Negated {
+		b.WriteString("^")
+	}
+	for _, r := range c.Ranges {
+		writeChar(b, r.Lo, true)
+		if r.Hi > r.Lo+1 {
+			b.WriteString("-")
+		}
+		if r.Hi > r.Lo {
+			writeChar(b, r.Hi, true)
+		}
+	}
+	b.WriteString("]")
+}
+
+func (c *Concat) write(b *strings.Builder) {
+	for i := 0; i < len(c.Subs); i++ {
+		switch sub := c.Subs[i].(type) {
+		case *Alternate:
+			b.WriteString("(?:")
+			sub.write(b)
+			b.WriteString(")")
+		case *Literal:
+			if !sub.Fold {
+				sub.write(b)
+				continue
+			}
+			// runs of caseless characters share one (?i:...)
+			b.WriteString("(?i:")
+			for ; i < len(c.Subs); i++ {
+				next, ok := c.Subs[i].(*Literal)
+				if !ok || !next.Fold {
+					break
+				}
+				for _, c := range next.Runes {
+					writeChar(b, c, false)
+				}
+			}
+			i--
+			b.WriteString(")")
+		default:
+			sub.write(b)
+		}
+	}
+}
+
+func (a *Alternate) write(b *strings.Builder) {
+	for i, sub := range a.Subs {
+		if i > 0 {
+			b.WriteString("|")
+		}
+		if _, ok := sub.(*Alternate); ok {
+			b.WriteString("(?:")
+			sub.write(b)
+			b.WriteString(")")
+			continue
+		}
+		sub.write(b)
+	}
+}
+
+func (r *Repeat) write(b *strings.Builder) {
+	// a quantifier only applies to the single character or group before it
+	atom := false
+	switch sub := r.Sub.(type) {
+	case *Literal:
+		atom = len(sub.Runes) == 1
+	case *Class, *Group, *Lookaround:
+		atom = true
+	}
+	if atom {
+		r.Sub.write(b)
+	} else {
+		b.WriteString("(?:")
+		r.Sub.write(b)
+		b.WriteString(")")
+	}
+	switch {
+	case r.Min == 0 && r.Max < 0:
+		b.WriteString("*")
+	case r.Min == 1 && r.Max < 0:
+		b.WriteString("+")
+	case r.Min == 0 && r.Max == 1:
+		b.WriteString("?")
+	case r.Max < 0:
+		fmt.Fprintf(b, "{%d,}", r.Min)
+	case r.Min == r.Max:
+		fmt.Fprintf(b, "{%d}", r.Min)
+	default:
+		fmt.Fprintf(b, "{%d,%d}", r.Min, r.Max)
+	}
+	if r.Lazy {
+		b.WriteString("?")
+	}
+}
+
+func (g *Group) write(b *strings.Builder) {
+	b.WriteString("(")
+	if g.Name != "" {
+		b.WriteString("?P<" + g.Name + ">")
+	}
+	g.Sub.write(b)
+	b.WriteString(")")
+}
+
+func (a *Assertion) write(b *strings.Builder) {
+	b.WriteString([...]string{`^`, `$`, `\Z`, `(?m:^)`, `(?m:$)`, `\b`, `\B`}[a.Kind])
+}
+
+func (l *Lookaround) write(b *strings.Builder) {
+	b.WriteString("(?")
+	if l.Behind {
+		b.WriteString("<")
+	}
+	if l.Negated {
+		b.WriteString("!")
+	} else {
+		b.WriteString("=")
+	}
+	l.Sub.write(b)
+	b.WriteString(")")
+}
+
+func (br *Backref) write(b *strings.Builder) {
+	if br.Fold {
+		b.WriteString("(?i:")
+	}
+	if br.Name != "" {
+		b.WriteString(`\k<` + br.Name + ">")
+	} else {
+		b.WriteString(`\` + strconv.Itoa(br.Index))
+	}
+	if br.Fold {
+		b.WriteString(")")
+	}
+}
+
+// the escapes written for control characters, the reverse of controlEscapes
+var controlNames = map[rune]string{
+	'\t': `\t`,
+	'\n': `\n`,
+	'\r': `\r`,
+	'\f': `\f`,
+	'\a': `\a`,
+	0x1b: `\e`,
+}
+
+// writeChar writes c so that it stands for itself, inside a set or out.
+// Anything past ASCII is written as a \x{...} escape, which means the same
+// character whether or not the pattern is read as UTF-8.
+func writeChar(b *strings.Builder, c rune, inSet bool) {
+	specials := `\.+*?()|[]{}^$`
+	if inSet {
+		specials = `\[]^-`
+	}
+	switch {
+	case strings.ContainsRune(specials, c):
+		b.WriteString(`\` + string(c))
+	case controlNames[c] != "":
+		b.WriteString(controlNames[c])
+	case c < ' ' || c > '~':
+		fmt.Fprintf(b, `\x{%x}`, c)
+	default:
+		b.WriteRune(c)
+	}
+}
@@ -0,0 +1,277 @@
+package syntax
+
+import (
+	"reflect"
+	"testing"
+)
+
+type StringInput struct {
+	name    string
+	pattern string
+	opts    Options
+	want    string // the canonical form
+}
+
+var utf8Mode = Options{UTF8: true}
+
+var stringTests = []StringInput{
+	{
+		name:    "plain",
+		pattern: "abc",
+		want:    "abc",
+	},
+	{
+		name:    "dot",
+		pattern: "a.b",
+		want:    `a[^\n]b`,
+	},
+	{
+		name:    "dot_newline",
+		pattern: "(?s).",
+		opts:    utf8Mode,
+		want:    "(?s:.)",
+	},
+	{
+		name:    "dot_newline_bytes",
+		pattern: "(?s).",
+		want:    `[\x{0}-\x{ff}]`,
+	},
+	{
+		name:    "metacharacters",
+		pattern: `\.\*\{\}a{,2}`,
+		want:    `\.\*\{\}a\{,2\}`,
+	},
+	{
+		name:    "top_level_bar_is_literal",
+		pattern: "x|y)",
+		want:    `x\|y\)`,
+	},
+	{
+		name:    "quantifier_at_start_is_literal",
+		pattern: "*a",
+		want:    `\*a`,
+	},
+	{
+		name:    "quantifiers",
+		pattern: "a?b+c*d{2}e{2,}f{2,3}g{0,1}",
+		want:    "a?b+c*d{2}e{2,}f{2,3}g?",
+	},
+	{
+		name:    "lazy",
+		pattern: "a??(b)+?c{2}?",
+		want:    "a??(b)+?c{2}?",
+	},
+	{
+		name:    "non_capturing_group_left_out",
+		pattern: "a(?:bc)d",
+		want:    "abcd",
+	},
+	{
+		name:    "repeated_non_capturing_group",
+		pattern: "(?:ab)*(?:c)+",
+		want:    "(?:ab)*c+",
+	},
+	{
+		name:    "alternation",
+		pattern: "x(?:a|bc)(d|e)",
+		want:    "x(?:a|bc)(d|e)",
+	},
+	{
+		name:    "nested_alternation",
+		pattern: "(?:(?:a|b)|c)",
+		want:    "(?:(?:a|b)|c)",
+	},
+	{
+		name:    "named_group",
+		pattern: "(?<year>\\d{4})-\\k<year>",
+		want:    `(?P<year>[0-9]{4})-\k<year>`,
+	},
+	{
+		name:    "backref",
+		pattern: `(a)(b)\2`,
+		want:    `(a)(b)\2`,
+	},
+	{
+		name:    "caseless",
+		pattern: "(?i)ab1c",
+		want:    "(?i:ab)1(?i:c)",
+	},
+	{
+		name:    "caseless_option",
+		pattern: `(a)[^k]\1`,
+		opts:    Options{CaseInsensitive: true},
+		want:    `((?i:a))[^Kk](?i:\1)`,
+	},
+	{
+		name:    "caseless_group_ends",
+		pattern: "a(?i:b)c",
+		want:    "a(?i:b)c",
+	},
+	{
+		name:    "multiline",
+		pattern: `(?m)^a$\A\z\Z`,
+		want:    `(?m:^)a(?m:$)^$\Z`,
+	},
+	{
+		name:    "word_boundaries",
+		pattern: `\bword\B`,
+		want:    `\bword\B`,
+	},
+	{
+		name:    "lookarounds",
+		pattern: "(?<=ab)c(?!d)(?<!e)(?=f)",
+		want:    "(?<=ab)c(?!d)(?<!e)(?=f)",
+	},
+	{
+		name:    "quantified_lookahead",
+		pattern: "(?=a)?b",
+		want:    "(?=a)?b",
+	},
+	{
+		name:    "sets",
+		pattern: `[a-cx\]\-^][^\d]`,
+		want:    `[\-\]\^a-cx][^0-9]`,
+	},
+	{
+		name:    "set_of_two",
+		pattern: "[ab]",
+		want:    "[ab]",
+	},
+	{
+		name:    "control_characters",
+		pattern: "\t\\n\\e\x01",
+		want:    `\t\n\e\x{1}`,
+	},
+	{
+		name:    "bytes",
+		pattern: "caf\xc3\xa9",
+		want:    `caf\x{c3}\x{a9}`,
+	},
+	{
+		name:    "runes",
+		pattern: "café",
+		opts:    utf8Mode,
+		want:    `caf\x{e9}`,
+	},
+	{
+		name:    "hex_escapes",
+		pattern: `\x41\x{42}[\x{0}-\x{1f}]`,
+		want:    `AB[\x{0}-\x{1f}]`,
+	},
+	{
+		name:    "nothing_matches",
+		pattern: `\P{Any}`,
+		opts:    utf8Mode,
+		want:    `\P{Any}`,
+	},
+	{
+		name:    "no_bytes_in_script",
+		pattern: `\p{Greek}`,
+		want:    `\P{Any}`,
+	},
+	{
+		name:    "flags_alone",
+		pattern: "(?i)",
+		want:    "(?:)",
+	},
+	{
+		name:    "empty_groups",
+		pattern: "()(?:)(?=)x",
+		want:    "()(?=)x",
+	},
+	{
+		name:    "empty_alternatives",
+		pattern: "(|a||b)(?:c|)",
+		want:    "(|a||b)(?:c|)",
+	},
+	{
+		name:    "repeated_empty_group",
+		pattern: "(?:)*()+",
+		want:    "(?:)*()+",
+	},
+}
+
+func TestString(t *testing.T) {
+	for _, tt := range stringTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := Parse(tt.pattern, tt.opts)
+			if err != nil {
+				t.Fatalf("Parse(%q) = %v", tt.pattern, err)
+			}
+			if got := tree.String(); got != tt.want {
+				t.Errorf("Parse(%q).String() = %q; want %q", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRoundTrip parses what String gives back in the same mode, which has
+// to give the same tree whatever options the first parse had
+func TestRoundTrip(t *testing.T) {
+	for _, tt := range stringTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := Parse(tt.pattern, tt.opts)
+			if err != nil {
+				t.Fatalf("Parse(%q) = %v", tt.pattern, err)
+			}
+			printed := tree.String()
+			again, err := Parse(printed, Options{UTF8: tt.opts.UTF8})
+			if err != nil {
+				t.Fatalf("Parse(%q) = %v", printed, err)
+			}
+			if !reflect.DeepEqual(again, tree) {
+				t.Errorf("Parse(%q) = %#v; want %#v", printed, again, tree)
+			}
+		})
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	for pattern, want := range map[string]Node{
+		"a(?:b|c)": &Concat{Subs: []Node{
+			&Literal{Runes: []rune{'a'}},
+			&Alternate{Subs: []Node{&Literal{Runes: []rune{'b'}}, &Literal{Runes: []rune{'c'}}}},
+		}},
+		"(x)+?": &Repeat{
+			Sub: &Group{Sub: &Literal{Runes: []rune{'x'}}, Index: 1},
+			Min: 1, Max: -1, Lazy: true,
+		},
+		"(?i)k1": &Concat{Subs: []Node{
+			&Literal{Runes: []rune{'k'}, Fold: true},
+			&Literal{Runes: []rune{'1'}},
+		}},
+		`(?<=a\b)`: &Lookaround{
+			Sub:    &Concat{Subs: []Node{&Literal{Runes: []rune{'a'}}, &Assertion{Kind: WordBoundary}}},
+			Behind: true,
+		},
+	} {
+		got, err := Parse(pattern, Options{})
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", pattern, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Parse(%q) = %s; want %s", pattern, got, want)
+		}
+	}
+}
+
+func TestWidth(t *testing.T) {
+	for pattern, want := range map[string][2]int{
+		"abc":         {3, 3},
+		"(?:a|bc)":    {1, 2},
+		"(?:ab){2,3}": {4, 6},
+		"a?b*":        {0, -1},
+		`\bx$`:        {1, 1},
+		`(a)\1`:       {1, -1},
+		"(?=abc)d":    {1, 1},
+		"x{0}":        {0, 0},
+	} {
+		tree, err := Parse(pattern, Options{})
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", pattern, err)
+		}
+		if lo, hi := Width(tree); lo != want[0] || hi != want[1] {
+			t.Errorf("Width(%q) = %d, %d; want %d, %d", pattern, lo, hi, want[0], want[1])
+		}
+	}
+}